@@ -4,15 +4,20 @@ go 1.20
 
 require (
 	github.com/dmarkham/enumer v1.5.8
+	github.com/gorilla/websocket v1.5.3
 	github.com/madkins23/go-utils v1.40.2
 	github.com/rs/zerolog v1.29.1
+	github.com/stretchr/testify v1.8.1
 )
 
 require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/pascaldekloe/name v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/mod v0.6.0-dev.0.20220419223038-86c51ed26bb4 // indirect
 	golang.org/x/sys v0.9.0 // indirect
 	golang.org/x/tools v0.1.12 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,373 @@
+package capability
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+const (
+	registerCapability   = "client/registerCapability"
+	unregisterCapability = "client/unregisterCapability"
+)
+
+// clientAreas are the client capabilities that group features.
+var clientAreas = map[string]bool{
+	"textDocument":     true,
+	"workspace":        true,
+	"window":           true,
+	"general":          true,
+	"notebookDocument": true,
+}
+
+var _ message.Observer = (*Reporter)(nil)
+
+// Reporter parses the capabilities negotiated by the initialize request and its response
+// for each connection between a client and the server.
+// Dynamic registrations via client/registerCapability are tracked
+// and requests sent although the other side did not advertise support are logged as warnings.
+// Connections are named by message.Entry.Connection.
+type Reporter struct {
+	logger      *zerolog.Logger
+	connections map[string]*connection
+	lock        sync.Mutex
+}
+
+// Report describes the capabilities negotiated on a single connection.
+type Report struct {
+	Connection     string          `json:"connection"`
+	Client         string          `json:"client"`
+	Server         string          `json:"server"`
+	ClientFeatures []string        `json:"clientFeatures"`
+	ServerFeatures []string        `json:"serverFeatures"`
+	Registrations  []*Registration `json:"registrations"`
+	Unsupported    []*Unsupported  `json:"unsupported"`
+}
+
+// Registration is a capability registered dynamically by the server.
+type Registration struct {
+	Time   time.Time `json:"time"`
+	ID     string    `json:"id"`
+	Method string    `json:"method"`
+	// Options is the raw JSON of the registerOptions or empty.
+	Options      string `json:"options"`
+	Unregistered bool   `json:"unregistered"`
+}
+
+// Unsupported counts the messages sent in one direction for a method
+// although the receiving side did not advertise the capability.
+type Unsupported struct {
+	First      time.Time `json:"first"`
+	Arrow      string    `json:"arrow"`
+	Method     string    `json:"method"`
+	Capability string    `json:"capability"`
+	Count      uint64    `json:"count"`
+}
+
+// connection holds the capabilities of a single connection.
+type connection struct {
+	client, server         string
+	clientCaps, serverCaps map[string]any
+	registrations          []*Registration
+	unsupported            map[string]*Unsupported
+}
+
+func NewReporter() *Reporter {
+	logger := log.With().Str("for", "capability").Logger()
+	return &Reporter{
+		logger:      &logger,
+		connections: make(map[string]*connection),
+	}
+}
+
+// Observe captures capabilities and registrations and checks requests against them.
+func (r *Reporter) Observe(entry *message.Entry) {
+	name, toServer := entry.Connection()
+	if name == "" {
+		return
+	}
+	fields := entry.Fields()
+	if fields.Type == message.TypeUnknown {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	conn, found := r.connections[name]
+	if !found {
+		conn = &connection{unsupported: make(map[string]*Unsupported)}
+		r.connections[name] = conn
+	}
+
+	switch {
+	case fields.Type == message.TypeResponse:
+		if !toServer && entry.RequestMethod == "initialize" && !fields.Error {
+			var response struct {
+				Result struct {
+					Capabilities map[string]any `json:"capabilities"`
+					ServerInfo   *info          `json:"serverInfo"`
+				} `json:"result"`
+			}
+			if err := json.Unmarshal(entry.Content, &response); err != nil {
+				return
+			}
+			conn.serverCaps = response.Result.Capabilities
+			conn.server = response.Result.ServerInfo.String()
+			r.logger.Info().Str("connection", name).Str("client", conn.client).Str("server", conn.server).
+				Strs("clientFeatures", clientFeatures(conn.clientCaps)).
+				Strs("serverFeatures", serverFeatures(conn.serverCaps)).
+				Msg("Capabilities negotiated")
+		}
+	case toServer && fields.Method == "initialize":
+		var request struct {
+			Params struct {
+				Capabilities map[string]any `json:"capabilities"`
+				ClientInfo   *info          `json:"clientInfo"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(entry.Content, &request); err != nil {
+			return
+		}
+		// Start over as a new initialize request means a new server session.
+		*conn = connection{
+			client:      request.Params.ClientInfo.String(),
+			clientCaps:  request.Params.Capabilities,
+			unsupported: make(map[string]*Unsupported),
+		}
+	case !toServer && fields.Method == registerCapability:
+		var request struct {
+			Params struct {
+				Registrations []struct {
+					ID              string          `json:"id"`
+					Method          string          `json:"method"`
+					RegisterOptions json.RawMessage `json:"registerOptions"`
+				} `json:"registrations"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(entry.Content, &request); err != nil {
+			return
+		}
+		for _, reg := range request.Params.Registrations {
+			conn.registrations = append(conn.registrations, &Registration{
+				Time:    entry.Time,
+				ID:      reg.ID,
+				Method:  reg.Method,
+				Options: string(reg.RegisterOptions),
+			})
+			if conn.clientCaps != nil {
+				if path := dynamicRegistration(reg.Method); path != "" && !supports(conn.clientCaps, path) {
+					r.unsupported(name, conn, entry, registerCapability+" "+reg.Method, path, "client")
+				}
+			}
+		}
+	case !toServer && fields.Method == unregisterCapability:
+		var request struct {
+			Params struct {
+				// The misspelling is part of the LSP specification.
+				Unregistrations []struct {
+					ID string `json:"id"`
+				} `json:"unregisterations"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(entry.Content, &request); err != nil {
+			return
+		}
+		for _, unreg := range request.Params.Unregistrations {
+			for _, reg := range conn.registrations {
+				if reg.ID == unreg.ID {
+					reg.Unregistered = true
+				}
+			}
+		}
+	case fields.Type == message.TypeRequest:
+		if toServer {
+			if req, found := serverRequirements[fields.Method]; found && conn.serverCaps != nil &&
+				!supports(conn.serverCaps, req.path) && !conn.registered(fields.Method, req.register) {
+				r.unsupported(name, conn, entry, fields.Method, req.path, "server")
+			}
+		} else if req, found := clientRequirements[fields.Method]; found && conn.clientCaps != nil &&
+			!supports(conn.clientCaps, req.path) {
+			r.unsupported(name, conn, entry, fields.Method, req.path, "client")
+		}
+	}
+}
+
+// Reports returns the capability reports for all connections sorted by connection name.
+// Returns nil if there is no Reporter.
+func (r *Reporter) Reports() []*Report {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	reports := make([]*Report, 0, len(r.connections))
+	for name, conn := range r.connections {
+		report := &Report{
+			Connection:     name,
+			Client:         conn.client,
+			Server:         conn.server,
+			ClientFeatures: clientFeatures(conn.clientCaps),
+			ServerFeatures: serverFeatures(conn.serverCaps),
+			Registrations:  make([]*Registration, 0, len(conn.registrations)),
+			Unsupported:    make([]*Unsupported, 0, len(conn.unsupported)),
+		}
+		for _, reg := range conn.registrations {
+			regCopy := *reg
+			report.Registrations = append(report.Registrations, &regCopy)
+		}
+		for _, unsup := range conn.unsupported {
+			unsupCopy := *unsup
+			report.Unsupported = append(report.Unsupported, &unsupCopy)
+		}
+		sort.Slice(report.Unsupported, func(i, j int) bool {
+			return report.Unsupported[i].First.Before(report.Unsupported[j].First)
+		})
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Connection < reports[j].Connection })
+	return reports
+}
+
+// LogSummary logs the negotiated capabilities and the unsupported requests of each connection.
+func (r *Reporter) LogSummary(logger *zerolog.Logger) {
+	for _, report := range r.Reports() {
+		active := 0
+		for _, reg := range report.Registrations {
+			if !reg.Unregistered {
+				active++
+			}
+		}
+		logger.Info().Str("connection", report.Connection).
+			Str("client", report.Client).Int("clientFeatures", len(report.ClientFeatures)).
+			Str("server", report.Server).Int("serverFeatures", len(report.ServerFeatures)).
+			Int("registrations", active).Msg("Capabilities")
+		for _, unsup := range report.Unsupported {
+			logger.Warn().Str("connection", report.Connection).Str("!", unsup.Arrow).
+				Str("method", unsup.Method).Str("capability", unsup.Capability).
+				Uint64("count", unsup.Count).Msg("Unsupported requests")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// unsupported counts a message for a capability the receiving side did not advertise
+// and logs a warning the first time.
+func (r *Reporter) unsupported(name string, conn *connection, entry *message.Entry, method, path, side string) {
+	key := entry.Arrow() + " " + method
+	if unsup, found := conn.unsupported[key]; found {
+		unsup.Count++
+		return
+	}
+	conn.unsupported[key] = &Unsupported{
+		First:      entry.Time,
+		Arrow:      entry.Arrow(),
+		Method:     method,
+		Capability: path,
+		Count:      1,
+	}
+	r.logger.Warn().Str("!", entry.Arrow()).Str("connection", name).
+		Str("method", method).Str("capability", path).
+		Msg("Capability not advertised by " + side)
+}
+
+// registered returns true if any of the methods has an active dynamic registration.
+func (c *connection) registered(methods ...string) bool {
+	for _, reg := range c.registrations {
+		if reg.Unregistered {
+			continue
+		}
+		for _, method := range methods {
+			if reg.Method == method {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// info is the clientInfo or serverInfo from initialization.
+type info struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func (i *info) String() string {
+	if i == nil {
+		return ""
+	}
+	if i.Version == "" {
+		return i.Name
+	}
+	return i.Name + " " + i.Version
+}
+
+// supports returns true if the capability at the dot-separated path is advertised.
+func supports(caps map[string]any, path string) bool {
+	var value any = caps
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return false
+		}
+		value = object[key]
+	}
+	return advertised(value)
+}
+
+// advertised returns true if the capability value indicates support.
+// Capabilities may be booleans, option objects, or (for textDocumentSync) a non-zero number.
+func advertised(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	}
+	return true
+}
+
+// clientFeatures returns the advertised client capabilities as sorted area.feature names.
+func clientFeatures(caps map[string]any) []string {
+	features := make([]string, 0)
+	for key, value := range caps {
+		if area, ok := value.(map[string]any); ok && clientAreas[key] {
+			for feature, setting := range area {
+				if advertised(setting) {
+					features = append(features, key+"."+feature)
+				}
+			}
+		} else if advertised(value) {
+			features = append(features, key)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// serverFeatures returns the advertised server capabilities as sorted names.
+func serverFeatures(caps map[string]any) []string {
+	features := make([]string, 0)
+	for key, value := range caps {
+		if workspace, ok := value.(map[string]any); ok && key == "workspace" {
+			for feature, setting := range workspace {
+				if advertised(setting) {
+					features = append(features, key+"."+feature)
+				}
+			}
+		} else if advertised(value) {
+			features = append(features, key)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
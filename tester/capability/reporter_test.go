@@ -0,0 +1,116 @@
+package capability
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+func TestSupports(t *testing.T) {
+	var caps map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"hoverProvider": true,
+		"definitionProvider": false,
+		"completionProvider": {"triggerCharacters": ["."]},
+		"codeLensProvider": {"resolveProvider": true},
+		"textDocumentSync": 0,
+		"documentSymbolProvider": null,
+		"semanticTokensProvider": {"full": {"delta": true}, "range": false},
+		"workspace": {"fileOperations": {"willRename": {"filters": []}}}
+	}`), &caps))
+	for _, test := range []struct {
+		path     string
+		supports bool
+	}{
+		{path: "hoverProvider", supports: true},
+		{path: "definitionProvider", supports: false},
+		{path: "referencesProvider", supports: false},
+		{path: "completionProvider", supports: true},
+		{path: "completionProvider.resolveProvider", supports: false},
+		{path: "codeLensProvider.resolveProvider", supports: true},
+		{path: "textDocumentSync", supports: false},
+		{path: "textDocumentSync.willSaveWaitUntil", supports: false},
+		{path: "documentSymbolProvider", supports: false},
+		{path: "semanticTokensProvider.full", supports: true},
+		{path: "semanticTokensProvider.full.delta", supports: true},
+		{path: "semanticTokensProvider.range", supports: false},
+		{path: "hoverProvider.extra", supports: false},
+		{path: "workspace.fileOperations.willRename", supports: true},
+		{path: "workspace.fileOperations.willDelete", supports: false},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			assert.Equal(t, test.supports, supports(caps, test.path))
+		})
+	}
+}
+
+func TestDynamicRegistration(t *testing.T) {
+	for _, test := range []struct {
+		method string
+		path   string
+	}{
+		{method: "textDocument/hover", path: "textDocument.hover.dynamicRegistration"},
+		{method: "textDocument/didOpen", path: "textDocument.synchronization.dynamicRegistration"},
+		{method: "textDocument/willSaveWaitUntil", path: "textDocument.synchronization.dynamicRegistration"},
+		{method: "textDocument/documentColor", path: "textDocument.colorProvider.dynamicRegistration"},
+		{method: "textDocument/prepareCallHierarchy", path: "textDocument.callHierarchy.dynamicRegistration"},
+		{method: "textDocument/semanticTokens", path: "textDocument.semanticTokens.dynamicRegistration"},
+		{method: "workspace/didChangeWatchedFiles", path: "workspace.didChangeWatchedFiles.dynamicRegistration"},
+		{method: "workspace/executeCommand", path: "workspace.executeCommand.dynamicRegistration"},
+		{method: "workspace/willRenameFiles", path: "workspace.fileOperations.dynamicRegistration"},
+		{method: "workspace/applyEdit", path: ""},
+		{method: "window/showMessage", path: ""},
+	} {
+		t.Run(test.method, func(t *testing.T) {
+			assert.Equal(t, test.path, dynamicRegistration(test.method))
+		})
+	}
+}
+
+func TestReporter_Observe(t *testing.T) {
+	reporter := NewReporter()
+	for _, entry := range []*message.Entry{
+		{From: "client-1", To: "server", Content: []byte(`{"id":1,"method":"initialize","params":{
+			"clientInfo":{"name":"editor","version":"1.0"},
+			"capabilities":{"textDocument":{"hover":{},"rename":{"dynamicRegistration":true}},"workspace":{"applyEdit":false}}}}`)},
+		{From: "server", To: "client-1", RequestMethod: "initialize", Content: []byte(`{"id":1,"result":{
+			"serverInfo":{"name":"lsp"},"capabilities":{"hoverProvider":true}}}`)},
+		{From: "client-1", To: "server", Content: []byte(`{"id":2,"method":"textDocument/hover","params":{}}`)},
+		{From: "client-1", To: "server", Content: []byte(`{"id":3,"method":"textDocument/definition","params":{}}`)},
+		{From: "client-1", To: "server", Content: []byte(`{"id":4,"method":"textDocument/definition","params":{}}`)},
+		{From: "server", To: "client-1", Content: []byte(`{"id":1,"method":"workspace/applyEdit","params":{}}`)},
+		{From: "server", To: "client-1", Content: []byte(`{"id":2,"method":"client/registerCapability","params":{"registrations":[
+			{"id":"r1","method":"textDocument/rename"},{"id":"r2","method":"textDocument/formatting"}]}}`)},
+		{From: "client-1", To: "server", Content: []byte(`{"id":5,"method":"textDocument/rename","params":{}}`)},
+		{From: "server", To: "client-1", Content: []byte(`{"id":3,"method":"client/unregisterCapability","params":{"unregisterations":[{"id":"r1"}]}}`)},
+		{From: "client-1", To: "server", Content: []byte(`{"id":6,"method":"textDocument/rename","params":{}}`)},
+	} {
+		reporter.Observe(entry)
+	}
+	reports := reporter.Reports()
+	require.Len(t, reports, 1)
+	report := reports[0]
+	assert.Equal(t, "client-1", report.Connection)
+	assert.Equal(t, "editor 1.0", report.Client)
+	assert.Equal(t, "lsp", report.Server)
+	assert.Equal(t, []string{"textDocument.hover", "textDocument.rename"}, report.ClientFeatures)
+	assert.Equal(t, []string{"hoverProvider"}, report.ServerFeatures)
+	require.Len(t, report.Registrations, 2)
+	assert.True(t, report.Registrations[0].Unregistered)
+	assert.False(t, report.Registrations[1].Unregistered)
+
+	unsupported := make(map[string]uint64)
+	for _, unsup := range report.Unsupported {
+		unsupported[unsup.Arrow+" "+unsup.Method] = unsup.Count
+	}
+	assert.Equal(t, map[string]uint64{
+		"server<--client-1 textDocument/definition":                           2,
+		"server-->client-1 workspace/applyEdit":                               1,
+		"server-->client-1 client/registerCapability textDocument/formatting": 1,
+		"server<--client-1 textDocument/rename":                               1,
+	}, unsupported)
+}
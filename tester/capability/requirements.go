@@ -0,0 +1,114 @@
+package capability
+
+import "strings"
+
+// requirement is the capability required for a request.
+type requirement struct {
+	// path is the dot-separated path of the capability in the capabilities object.
+	path string
+	// register is the method which may be registered dynamically instead (defaults to the request method).
+	register string
+}
+
+// serverRequirements are the server capabilities required for requests from the client.
+var serverRequirements = map[string]requirement{
+	"textDocument/hover":                {path: "hoverProvider"},
+	"textDocument/completion":           {path: "completionProvider"},
+	"completionItem/resolve":            {path: "completionProvider.resolveProvider", register: "textDocument/completion"},
+	"textDocument/signatureHelp":        {path: "signatureHelpProvider"},
+	"textDocument/declaration":          {path: "declarationProvider"},
+	"textDocument/definition":           {path: "definitionProvider"},
+	"textDocument/typeDefinition":       {path: "typeDefinitionProvider"},
+	"textDocument/implementation":       {path: "implementationProvider"},
+	"textDocument/references":           {path: "referencesProvider"},
+	"textDocument/documentHighlight":    {path: "documentHighlightProvider"},
+	"textDocument/documentSymbol":       {path: "documentSymbolProvider"},
+	"textDocument/codeAction":           {path: "codeActionProvider"},
+	"codeAction/resolve":                {path: "codeActionProvider.resolveProvider", register: "textDocument/codeAction"},
+	"textDocument/codeLens":             {path: "codeLensProvider"},
+	"codeLens/resolve":                  {path: "codeLensProvider.resolveProvider", register: "textDocument/codeLens"},
+	"textDocument/documentLink":         {path: "documentLinkProvider"},
+	"documentLink/resolve":              {path: "documentLinkProvider.resolveProvider", register: "textDocument/documentLink"},
+	"textDocument/documentColor":        {path: "colorProvider"},
+	"textDocument/colorPresentation":    {path: "colorProvider", register: "textDocument/documentColor"},
+	"textDocument/formatting":           {path: "documentFormattingProvider"},
+	"textDocument/rangeFormatting":      {path: "documentRangeFormattingProvider"},
+	"textDocument/onTypeFormatting":     {path: "documentOnTypeFormattingProvider"},
+	"textDocument/rename":               {path: "renameProvider"},
+	"textDocument/prepareRename":        {path: "renameProvider.prepareProvider", register: "textDocument/rename"},
+	"textDocument/foldingRange":         {path: "foldingRangeProvider"},
+	"textDocument/selectionRange":       {path: "selectionRangeProvider"},
+	"textDocument/prepareCallHierarchy": {path: "callHierarchyProvider"},
+	"callHierarchy/incomingCalls":       {path: "callHierarchyProvider", register: "textDocument/prepareCallHierarchy"},
+	"callHierarchy/outgoingCalls":       {path: "callHierarchyProvider", register: "textDocument/prepareCallHierarchy"},
+	"textDocument/prepareTypeHierarchy": {path: "typeHierarchyProvider"},
+	"typeHierarchy/supertypes":          {path: "typeHierarchyProvider", register: "textDocument/prepareTypeHierarchy"},
+	"typeHierarchy/subtypes":            {path: "typeHierarchyProvider", register: "textDocument/prepareTypeHierarchy"},
+	"textDocument/semanticTokens/full":  {path: "semanticTokensProvider.full", register: "textDocument/semanticTokens"},
+	"textDocument/semanticTokens/full/delta": {
+		path: "semanticTokensProvider.full.delta", register: "textDocument/semanticTokens"},
+	"textDocument/semanticTokens/range": {path: "semanticTokensProvider.range", register: "textDocument/semanticTokens"},
+	"textDocument/linkedEditingRange":   {path: "linkedEditingRangeProvider"},
+	"textDocument/moniker":              {path: "monikerProvider"},
+	"textDocument/inlayHint":            {path: "inlayHintProvider"},
+	"inlayHint/resolve":                 {path: "inlayHintProvider.resolveProvider", register: "textDocument/inlayHint"},
+	"textDocument/inlineValue":          {path: "inlineValueProvider"},
+	"textDocument/diagnostic":           {path: "diagnosticProvider"},
+	"workspace/diagnostic":              {path: "diagnosticProvider.workspaceDiagnostics", register: "textDocument/diagnostic"},
+	"textDocument/willSaveWaitUntil":    {path: "textDocumentSync.willSaveWaitUntil"},
+	"workspace/symbol":                  {path: "workspaceSymbolProvider"},
+	"workspaceSymbol/resolve":           {path: "workspaceSymbolProvider.resolveProvider", register: "workspace/symbol"},
+	"workspace/executeCommand":          {path: "executeCommandProvider"},
+	"workspace/willCreateFiles":         {path: "workspace.fileOperations.willCreate"},
+	"workspace/willRenameFiles":         {path: "workspace.fileOperations.willRename"},
+	"workspace/willDeleteFiles":         {path: "workspace.fileOperations.willDelete"},
+}
+
+// clientRequirements are the client capabilities required for requests from the server.
+var clientRequirements = map[string]requirement{
+	"workspace/configuration":          {path: "workspace.configuration"},
+	"workspace/workspaceFolders":       {path: "workspace.workspaceFolders"},
+	"workspace/applyEdit":              {path: "workspace.applyEdit"},
+	"workspace/semanticTokens/refresh": {path: "workspace.semanticTokens.refreshSupport"},
+	"workspace/codeLens/refresh":       {path: "workspace.codeLens.refreshSupport"},
+	"workspace/inlayHint/refresh":      {path: "workspace.inlayHint.refreshSupport"},
+	"workspace/inlineValue/refresh":    {path: "workspace.inlineValue.refreshSupport"},
+	"workspace/diagnostic/refresh":     {path: "workspace.diagnostics.refreshSupport"},
+	"window/workDoneProgress/create":   {path: "window.workDoneProgress"},
+	"window/showDocument":              {path: "window.showDocument.support"},
+}
+
+// textDocumentFeatures are the client textDocument capabilities for methods
+// that don't match the capability name.
+var textDocumentFeatures = map[string]string{
+	"didOpen":              "synchronization",
+	"didChange":            "synchronization",
+	"didClose":             "synchronization",
+	"willSave":             "synchronization",
+	"willSaveWaitUntil":    "synchronization",
+	"didSave":              "synchronization",
+	"documentColor":        "colorProvider",
+	"prepareCallHierarchy": "callHierarchy",
+	"prepareTypeHierarchy": "typeHierarchy",
+}
+
+// dynamicRegistration returns the path of the client capability
+// that allows the server to register the method dynamically.
+// Returns an empty string if the method is unknown.
+func dynamicRegistration(method string) string {
+	if feature, found := strings.CutPrefix(method, "textDocument/"); found {
+		if name, found := textDocumentFeatures[feature]; found {
+			feature = name
+		}
+		return "textDocument." + feature + ".dynamicRegistration"
+	}
+	switch method {
+	case "workspace/didChangeWatchedFiles", "workspace/didChangeConfiguration",
+		"workspace/symbol", "workspace/executeCommand":
+		return "workspace." + strings.TrimPrefix(method, "workspace/") + ".dynamicRegistration"
+	case "workspace/didCreateFiles", "workspace/willCreateFiles", "workspace/didRenameFiles",
+		"workspace/willRenameFiles", "workspace/didDeleteFiles", "workspace/willDeleteFiles":
+		return "workspace.fileOperations.dynamicRegistration"
+	}
+	return ""
+}
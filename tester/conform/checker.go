@@ -0,0 +1,460 @@
+package conform
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+const (
+	// maxProblems is the number of recent problems kept for the web server.
+	maxProblems = 1000
+	// maxMessageProblems is the number of problems reported for a single message.
+	maxMessageProblems = 10
+	// maxDepth limits recursion through nested types.
+	maxDepth = 64
+)
+
+var _ message.Observer = (*Checker)(nil)
+
+// Checker checks messages against the LSP specification in the metaModel.json file
+// specified by the -metaModel flag.
+// Unknown methods, messages sent in the wrong direction, missing required fields,
+// and type mismatches in params and results are logged as warnings and kept for the web server.
+// Extra fields are allowed as LSP implementations may extend the protocol.
+type Checker struct {
+	logger        *zerolog.Logger
+	version       string
+	methods       map[string]*method
+	structures    map[string]*structure
+	enumerations  map[string]*enumeration
+	aliases       map[string]*typeAlias
+	summary       map[string]*MethodSummary
+	problems      []*Problem
+	next          int
+	totalMessages int
+	totalProblems int
+	lock          sync.Mutex
+}
+
+// MethodSummary counts the messages checked and the problems found for a single method.
+type MethodSummary struct {
+	Method   string `json:"method"`
+	Messages int    `json:"messages"`
+	Problems int    `json:"problems"`
+}
+
+// Problem describes a single conformance problem in a message.
+type Problem struct {
+	Time   time.Time `json:"time"`
+	Arrow  string    `json:"arrow"`
+	Method string    `json:"method"`
+	// Path is the dot-separated path to the field with the problem (e.g. "params.position.line").
+	Path string `json:"path"`
+	Text string `json:"text"`
+}
+
+// NewChecker loads the metaModel file specified by the -metaModel flag.
+func NewChecker(flags *flags.Set) (*Checker, error) {
+	model, err := loadMetaModel(flags.MetaModelPath())
+	if err != nil {
+		return nil, err
+	}
+	logger := log.With().Str("for", "conform").Logger()
+	c := &Checker{
+		logger:       &logger,
+		version:      model.MetaData.Version,
+		methods:      make(map[string]*method, len(model.Requests)+len(model.Notifications)),
+		structures:   make(map[string]*structure, len(model.Structures)),
+		enumerations: make(map[string]*enumeration, len(model.Enumerations)),
+		aliases:      make(map[string]*typeAlias, len(model.TypeAliases)),
+		summary:      make(map[string]*MethodSummary),
+		problems:     make([]*Problem, 0, maxProblems),
+	}
+	for _, mthd := range model.Requests {
+		c.methods[mthd.Method] = mthd
+	}
+	for _, mthd := range model.Notifications {
+		c.methods[mthd.Method] = mthd
+	}
+	for _, strct := range model.Structures {
+		c.structures[strct.Name] = strct
+	}
+	for _, enum := range model.Enumerations {
+		c.enumerations[enum.Name] = enum
+	}
+	for _, alias := range model.TypeAliases {
+		c.aliases[alias.Name] = alias
+	}
+	for _, strct := range model.Structures {
+		c.properties(strct, 0)
+	}
+	logger.Info().Str("version", c.version).Int("methods", len(c.methods)).Msg("Loaded metaModel")
+	return c, nil
+}
+
+// Version returns the LSP version of the metaModel.
+func (c *Checker) Version() string {
+	return c.version
+}
+
+// Observe checks a message.
+func (c *Checker) Observe(entry *message.Entry) {
+	fields := entry.Fields()
+	var anyMsg map[string]any
+	if err := json.Unmarshal(entry.Content, &anyMsg); err != nil {
+		return
+	}
+	var name string
+	var problems []*Problem
+	check := &checking{checker: c}
+	switch fields.Type {
+	case message.TypeRequest, message.TypeNotification:
+		name = fields.Method
+		check.params(entry, fields, anyMsg["params"])
+	case message.TypeResponse:
+		name = entry.RequestMethod
+		if name == "" || fields.Error {
+			// Can't check a response to an unknown request or an error.
+			return
+		}
+		if mthd, found := c.methods[name]; found && mthd.Result != nil {
+			check.value(anyMsg["result"], mthd.Result, "result", 0)
+		}
+	default:
+		return
+	}
+	for _, fnd := range check.problems {
+		problems = append(problems, &Problem{
+			Time:   entry.Time,
+			Arrow:  entry.Arrow(),
+			Method: name,
+			Path:   fnd.path,
+			Text:   fnd.text,
+		})
+	}
+	c.record(name, problems)
+}
+
+// Summary returns the counts for all methods sorted by method name.
+func (c *Checker) Summary() []*MethodSummary {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	summary := make([]*MethodSummary, 0, len(c.summary))
+	for _, ms := range c.summary {
+		msCopy := *ms
+		summary = append(summary, &msCopy)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Method < summary[j].Method })
+	return summary
+}
+
+// Problems returns the most recent problems in order.
+func (c *Checker) Problems() []*Problem {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	problems := make([]*Problem, 0, len(c.problems))
+	problems = append(problems, c.problems[c.next:]...)
+	return append(problems, c.problems[:c.next]...)
+}
+
+// LogSummary logs the number of messages checked and problems found for each method with problems.
+func (c *Checker) LogSummary(logger *zerolog.Logger) {
+	for _, ms := range c.Summary() {
+		if ms.Problems > 0 {
+			logger.Warn().Str("method", ms.Method).Int("messages", ms.Messages).Int("problems", ms.Problems).
+				Msg("Conformance")
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	logger.Info().Int("messages", c.totalMessages).Int("problems", c.totalProblems).Msg("Conformance")
+}
+
+//-----------------------------------------------------------------------------
+
+// record logs the problems for a message and counts them.
+func (c *Checker) record(method string, problems []*Problem) {
+	for _, problem := range problems {
+		c.logger.Warn().Str("!", problem.Arrow).Str("method", method).Str("path", problem.Path).
+			Msg(problem.Text)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ms, found := c.summary[method]
+	if !found {
+		ms = &MethodSummary{Method: method}
+		c.summary[method] = ms
+	}
+	ms.Messages++
+	ms.Problems += len(problems)
+	c.totalMessages++
+	c.totalProblems += len(problems)
+	for _, problem := range problems {
+		if len(c.problems) < maxProblems {
+			c.problems = append(c.problems, problem)
+		} else {
+			c.problems[c.next] = problem
+			c.next = (c.next + 1) % maxProblems
+		}
+	}
+}
+
+// checking accumulates the problems found in a single message.
+type checking struct {
+	checker  *Checker
+	problems []*finding
+}
+
+// finding is a problem found at a path in a message.
+type finding struct {
+	path, text string
+}
+
+func (ck *checking) problem(path, format string, args ...any) {
+	if len(ck.problems) < maxMessageProblems {
+		ck.problems = append(ck.problems, &finding{path: path, text: fmt.Sprintf(format, args...)})
+	}
+}
+
+// params checks the method and direction of a request or notification and its parameters.
+func (ck *checking) params(entry *message.Entry, fields *message.Fields, params any) {
+	mthd, found := ck.checker.methods[fields.Method]
+	if !found {
+		ck.problem("method", "unknown method %s", fields.Method)
+		return
+	}
+	if mthd.notification && fields.Type == message.TypeRequest {
+		ck.problem("id", "notification sent as a request")
+	} else if !mthd.notification && fields.Type == message.TypeNotification {
+		ck.problem("id", "request sent as a notification")
+	}
+	switch direction := entry.Direction(); {
+	case mthd.MessageDirection == "clientToServer" && direction == message.ToClient:
+		ck.problem("method", "client to server method sent to client")
+	case mthd.MessageDirection == "serverToClient" && direction == message.ToServer:
+		ck.problem("method", "server to client method sent to server")
+	}
+	switch len(mthd.paramTypes) {
+	case 0:
+		if params != nil {
+			ck.problem("params", "method has no params")
+		}
+	case 1:
+		if params == nil {
+			ck.problem("params", "missing required field")
+		} else {
+			ck.value(params, mthd.paramTypes[0], "params", 0)
+		}
+	default:
+		array, ok := params.([]any)
+		if !ok {
+			ck.problem("params", "expected array of %d params", len(mthd.paramTypes))
+			return
+		}
+		for i, paramType := range mthd.paramTypes {
+			if i < len(array) {
+				ck.value(array[i], paramType, "params."+strconv.Itoa(i), 0)
+			}
+		}
+	}
+}
+
+// value checks that the value matches the type.
+func (ck *checking) value(value any, typ *lspType, path string, depth int) {
+	if typ == nil || depth > maxDepth {
+		return
+	}
+	depth++
+	switch typ.Kind {
+	case "base":
+		ck.base(value, typ.Name, path)
+	case "reference":
+		ck.reference(value, typ.Name, path, depth)
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			ck.mismatch(value, typ, path)
+			return
+		}
+		for i, element := range array {
+			ck.value(element, typ.Element, path+"."+strconv.Itoa(i), depth)
+		}
+	case "map":
+		hash, ok := value.(map[string]any)
+		if !ok {
+			ck.mismatch(value, typ, path)
+			return
+		}
+		for _, key := range sortedKeys(hash) {
+			ck.value(hash[key], typ.valueType, path+"."+key, depth)
+		}
+	case "and":
+		for _, item := range typ.Items {
+			ck.value(value, item, path, depth)
+		}
+	case "or":
+		if !ck.matchesAny(value, typ.Items, path, depth) {
+			ck.mismatch(value, typ, path)
+		}
+	case "tuple":
+		array, ok := value.([]any)
+		if !ok || len(array) != len(typ.Items) {
+			ck.mismatch(value, typ, path)
+			return
+		}
+		for i, item := range typ.Items {
+			ck.value(array[i], item, path+"."+strconv.Itoa(i), depth)
+		}
+	case "literal":
+		ck.structure(value, typ.literal, path, depth)
+	case "stringLiteral", "integerLiteral", "booleanLiteral":
+		// Both values are unmarshaled from JSON so numbers are float64.
+		if value != typ.constant {
+			ck.mismatch(value, typ, path)
+		}
+	}
+}
+
+// matchesAny returns true if the value matches one of the types without any problems.
+func (ck *checking) matchesAny(value any, types []*lspType, path string, depth int) bool {
+	for _, item := range types {
+		trial := &checking{checker: ck.checker}
+		trial.value(value, item, path, depth)
+		if len(trial.problems) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// base checks that the value matches a base type.
+func (ck *checking) base(value any, name, path string) {
+	ok := false
+	switch name {
+	case "string", "URI", "DocumentUri", "RegExp":
+		_, ok = value.(string)
+	case "boolean":
+		_, ok = value.(bool)
+	case "null":
+		ok = value == nil
+	case "decimal":
+		_, ok = value.(float64)
+	case "integer":
+		number, isNumber := value.(float64)
+		ok = isNumber && number == math.Trunc(number) && number >= math.MinInt32 && number <= math.MaxInt32
+	case "uinteger":
+		number, isNumber := value.(float64)
+		ok = isNumber && number == math.Trunc(number) && number >= 0 && number <= math.MaxUint32
+	default:
+		// Unknown base type.
+		ok = true
+	}
+	if !ok {
+		ck.problem(path, "expected %s, found %s", name, describe(value))
+	}
+}
+
+// reference checks that the value matches a named structure, enumeration, or type alias.
+func (ck *checking) reference(value any, name, path string, depth int) {
+	if strct, found := ck.checker.structures[name]; found {
+		ck.structure(value, strct, path, depth)
+	} else if enum, found := ck.checker.enumerations[name]; found {
+		ck.value(value, enum.Type, path, depth)
+		if enum.SupportsCustomValues || len(ck.problems) >= maxMessageProblems {
+			return
+		}
+		for _, enumValue := range enum.Values {
+			// Both values are unmarshaled from JSON so numbers are float64.
+			if value == enumValue.Value {
+				return
+			}
+		}
+		ck.problem(path, "%s is not a %s value", describe(value), name)
+	} else if alias, found := ck.checker.aliases[name]; found {
+		ck.value(value, alias.Type, path, depth)
+	}
+}
+
+// structure checks that the value is an object with all the required properties of the structure
+// and that the properties that are present have the correct types.
+func (ck *checking) structure(value any, strct *structure, path string, depth int) {
+	hash, ok := value.(map[string]any)
+	if !ok {
+		ck.problem(path, "expected %s, found %s", strct.Name, describe(value))
+		return
+	}
+	for _, prop := range strct.all {
+		field, found := hash[prop.Name]
+		if !found {
+			if !prop.Optional {
+				ck.problem(path+"."+prop.Name, "missing required field")
+			}
+			continue
+		}
+		ck.value(field, prop.Type, path+"."+prop.Name, depth)
+	}
+}
+
+// properties returns all properties of a structure including those it extends or mixes in.
+// The result is kept in the structure.
+func (c *Checker) properties(strct *structure, depth int) []*property {
+	if strct.all != nil || depth > maxDepth {
+		return strct.all
+	}
+	all := make([]*property, 0, len(strct.Properties))
+	for _, parents := range [][]*lspType{strct.Extends, strct.Mixins} {
+		for _, parent := range parents {
+			if parentStruct, found := c.structures[parent.Name]; found {
+				all = append(all, c.properties(parentStruct, depth+1)...)
+			}
+		}
+	}
+	strct.all = append(all, strct.Properties...)
+	return strct.all
+}
+
+// mismatch adds a problem for a value that doesn't match the type.
+func (ck *checking) mismatch(value any, typ *lspType, path string) {
+	ck.problem(path, "expected %s, found %s", typ, describe(value))
+}
+
+// describe returns the JSON type of a value.
+func describe(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number " + strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// sortedKeys returns the keys of a map in order so that problems are reported in a stable order.
+func sortedKeys(hash map[string]any) []string {
+	keys := make([]string, 0, len(hash))
+	for key := range hash {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
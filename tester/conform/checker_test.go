@@ -0,0 +1,161 @@
+package conform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+// testMetaModel is a small part of the LSP metaModel.
+const testMetaModel = `{
+  "metaData": { "version": "3.17.0" },
+  "requests": [
+    { "method": "textDocument/hover", "messageDirection": "clientToServer",
+      "params": { "kind": "reference", "name": "HoverParams" },
+      "result": { "kind": "or", "items": [ { "kind": "reference", "name": "Hover" }, { "kind": "base", "name": "null" } ] } },
+    { "method": "shutdown", "messageDirection": "clientToServer",
+      "result": { "kind": "base", "name": "null" } }
+  ],
+  "notifications": [
+    { "method": "window/logMessage", "messageDirection": "serverToClient",
+      "params": { "kind": "reference", "name": "LogMessageParams" } },
+    { "method": "$/setTrace", "messageDirection": "clientToServer",
+      "params": { "kind": "literal", "value": { "properties": [
+        { "name": "value", "type": { "kind": "reference", "name": "TraceValues" } } ] } } },
+    { "method": "exit", "messageDirection": "clientToServer" }
+  ],
+  "structures": [
+    { "name": "TextDocumentIdentifier", "properties": [
+      { "name": "uri", "type": { "kind": "base", "name": "DocumentUri" } } ] },
+    { "name": "Position", "properties": [
+      { "name": "line", "type": { "kind": "base", "name": "uinteger" } },
+      { "name": "character", "type": { "kind": "base", "name": "uinteger" } } ] },
+    { "name": "TextDocumentPositionParams", "properties": [
+      { "name": "textDocument", "type": { "kind": "reference", "name": "TextDocumentIdentifier" } },
+      { "name": "position", "type": { "kind": "reference", "name": "Position" } } ] },
+    { "name": "HoverParams", "extends": [ { "kind": "reference", "name": "TextDocumentPositionParams" } ],
+      "properties": [
+        { "name": "workDoneToken", "type": { "kind": "base", "name": "string" }, "optional": true } ] },
+    { "name": "Hover", "properties": [
+      { "name": "contents", "type": { "kind": "or", "items": [
+        { "kind": "base", "name": "string" },
+        { "kind": "array", "element": { "kind": "base", "name": "string" } } ] } },
+      { "name": "data", "type": { "kind": "map", "key": { "kind": "base", "name": "string" },
+        "value": { "kind": "base", "name": "integer" } }, "optional": true } ] },
+    { "name": "LogMessageParams", "properties": [
+      { "name": "type", "type": { "kind": "reference", "name": "MessageType" } },
+      { "name": "message", "type": { "kind": "base", "name": "string" } } ] }
+  ],
+  "enumerations": [
+    { "name": "MessageType", "type": { "kind": "base", "name": "uinteger" },
+      "values": [ { "value": 1 }, { "value": 2 }, { "value": 3 }, { "value": 4 } ] }
+  ],
+  "typeAliases": [
+    { "name": "TraceValues", "type": { "kind": "or", "items": [
+      { "kind": "stringLiteral", "value": "off" },
+      { "kind": "stringLiteral", "value": "messages" },
+      { "kind": "stringLiteral", "value": "verbose" } ] } }
+  ]
+}`
+
+func newTestChecker(t *testing.T) *Checker {
+	path := filepath.Join(t.TempDir(), "metaModel.json")
+	require.NoError(t, os.WriteFile(path, []byte(testMetaModel), 0o600))
+	set := flags.NewSet()
+	require.NoError(t, set.Parse([]string{"-metaModel", path}))
+	checker, err := NewChecker(set)
+	require.NoError(t, err)
+	return checker
+}
+
+func TestChecker_Observe(t *testing.T) {
+	const hover = `"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///a.go"},"position":{"line":1,"character":2}}`
+	for _, test := range []struct {
+		name          string
+		to            string
+		content       string
+		requestMethod string
+		problems      []string
+	}{
+		{name: "valid request", to: "server", content: `{"id":1,` + hover + `}`},
+		{
+			name: "missing and wrong fields", to: "server",
+			content: `{"id":1,"method":"textDocument/hover","params":{"textDocument":{},"position":{"line":-1,"character":"2"}}}`,
+			problems: []string{
+				"params.textDocument.uri: missing required field",
+				"params.position.line: expected uinteger, found number -1",
+				"params.position.character: expected uinteger, found string",
+			},
+		},
+		{name: "extra field", to: "server", content: `{"id":1,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///a.go","extra":true},"position":{"line":1,"character":2}}}`},
+		{name: "unknown method", to: "server", content: `{"id":1,"method":"textDocument/unknown"}`, problems: []string{"method: unknown method textDocument/unknown"}},
+		{name: "request as notification", to: "server", content: `{` + hover + `}`, problems: []string{"id: request sent as a notification"}},
+		{name: "notification as request", to: "server", content: `{"id":2,"method":"exit"}`, problems: []string{"id: notification sent as a request"}},
+		{
+			name: "wrong direction", to: "client-1", content: `{"id":1,` + hover + `}`,
+			problems: []string{"method: client to server method sent to client"},
+		},
+		{name: "unexpected params", to: "server", content: `{"method":"exit","params":{}}`, problems: []string{"params: method has no params"}},
+		{name: "missing params", to: "client-1", content: `{"method":"window/logMessage"}`, problems: []string{"params: missing required field"}},
+		{name: "enumeration", to: "client-1", content: `{"method":"window/logMessage","params":{"type":3,"message":"x"}}`},
+		{
+			name: "bad enumeration", to: "client-1", content: `{"method":"window/logMessage","params":{"type":7,"message":"x"}}`,
+			problems: []string{"params.type: number 7 is not a MessageType value"},
+		},
+		{name: "literal alias", to: "server", content: `{"method":"$/setTrace","params":{"value":"verbose"}}`},
+		{
+			name: "bad literal alias", to: "server", content: `{"method":"$/setTrace","params":{"value":"loud"}}`,
+			problems: []string{"params.value: expected off | messages | verbose, found string"},
+		},
+		{name: "result", to: "client-1", requestMethod: "textDocument/hover", content: `{"id":1,"result":{"contents":["a","b"],"data":{"x":1}}}`},
+		{name: "null result", to: "client-1", requestMethod: "textDocument/hover", content: `{"id":1,"result":null}`},
+		{
+			name: "bad result", to: "client-1", requestMethod: "textDocument/hover", content: `{"id":1,"result":{"contents":1}}`,
+			problems: []string{"result: expected Hover | null, found object"},
+		},
+		{
+			name: "bad null result", to: "client-1", requestMethod: "shutdown", content: `{"id":1,"result":{}}`,
+			problems: []string{"result: expected null, found object"},
+		},
+		{name: "error response", to: "client-1", requestMethod: "textDocument/hover", content: `{"id":1,"error":{"code":-1,"message":"x"}}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			checker := newTestChecker(t)
+			from := "client-1"
+			if test.to != "server" {
+				from = "server"
+			}
+			checker.Observe(&message.Entry{From: from, To: test.to, Content: []byte(test.content), RequestMethod: test.requestMethod})
+			problems := make([]string, 0)
+			for _, problem := range checker.Problems() {
+				problems = append(problems, problem.Path+": "+problem.Text)
+			}
+			if test.problems == nil {
+				test.problems = []string{}
+			}
+			assert.Equal(t, test.problems, problems)
+		})
+	}
+}
+
+func TestChecker_Summary(t *testing.T) {
+	checker := newTestChecker(t)
+	for _, content := range []string{
+		`{"method":"exit"}`,
+		`{"method":"exit","params":1}`,
+		`{"id":1,"method":"textDocument/unknown"}`,
+	} {
+		checker.Observe(&message.Entry{From: "client-1", To: "server", Content: []byte(content)})
+	}
+	assert.Equal(t, []*MethodSummary{
+		{Method: "exit", Messages: 2, Problems: 1},
+		{Method: "textDocument/unknown", Messages: 1, Problems: 1},
+	}, checker.Summary())
+	assert.Equal(t, "3.17.0", checker.Version())
+}
@@ -0,0 +1,218 @@
+package conform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// metaModel is the machine-readable LSP specification published as metaModel.json.
+// Only the parts used for checking messages are unmarshaled.
+type metaModel struct {
+	MetaData struct {
+		Version string `json:"version"`
+	} `json:"metaData"`
+	Requests      []*method      `json:"requests"`
+	Notifications []*method      `json:"notifications"`
+	Structures    []*structure   `json:"structures"`
+	Enumerations  []*enumeration `json:"enumerations"`
+	TypeAliases   []*typeAlias   `json:"typeAliases"`
+}
+
+// method is a request or notification.
+type method struct {
+	Method string `json:"method"`
+	// Params is a single type or an array of types (unmarshaled into paramTypes).
+	Params json.RawMessage `json:"params"`
+	// Result is nil for a notification.
+	Result *lspType `json:"result"`
+	// MessageDirection is clientToServer, serverToClient, or both.
+	MessageDirection string `json:"messageDirection"`
+	paramTypes       []*lspType
+	notification     bool
+}
+
+type structure struct {
+	Name       string      `json:"name"`
+	Properties []*property `json:"properties"`
+	Extends    []*lspType  `json:"extends"`
+	Mixins     []*lspType  `json:"mixins"`
+	// all contains the properties including those from Extends and Mixins.
+	all []*property
+}
+
+type property struct {
+	Name     string   `json:"name"`
+	Type     *lspType `json:"type"`
+	Optional bool     `json:"optional"`
+}
+
+type enumeration struct {
+	Name   string   `json:"name"`
+	Type   *lspType `json:"type"`
+	Values []*struct {
+		Value any `json:"value"`
+	} `json:"values"`
+	SupportsCustomValues bool `json:"supportsCustomValues"`
+}
+
+type typeAlias struct {
+	Name string   `json:"name"`
+	Type *lspType `json:"type"`
+}
+
+// lspType is a type in the metaModel.
+// The fields used depend on the Kind.
+type lspType struct {
+	// Kind is base, reference, array, map, and, or, tuple, literal,
+	// stringLiteral, integerLiteral, or booleanLiteral.
+	Kind string `json:"kind"`
+	// Name is the name of a base or reference type.
+	Name string `json:"name"`
+	// Element is the element type of an array.
+	Element *lspType `json:"element"`
+	// Key and Value are the key and value types of a map.
+	Key   *lspType        `json:"key"`
+	Value json.RawMessage `json:"value"`
+	// Items are the types of and, or, and tuple types.
+	Items []*lspType `json:"items"`
+	// valueType is the value type of a map.
+	valueType *lspType
+	// literal is the structure of a literal.
+	literal *structure
+	// constant is the value of a stringLiteral, integerLiteral, or booleanLiteral.
+	constant any
+}
+
+// loadMetaModel loads and prepares the metaModel file at the specified path.
+func loadMetaModel(path string) (*metaModel, error) {
+	var model metaModel
+	if content, err := os.ReadFile(path); err != nil {
+		return nil, fmt.Errorf("read metaModel file %s: %w", path, err)
+	} else if err := json.Unmarshal(content, &model); err != nil {
+		return nil, fmt.Errorf("unmarshal metaModel file %s: %w", path, err)
+	}
+	for _, request := range model.Requests {
+		if err := request.prepare(); err != nil {
+			return nil, fmt.Errorf("request %s: %w", request.Method, err)
+		}
+	}
+	for _, notification := range model.Notifications {
+		notification.notification = true
+		if err := notification.prepare(); err != nil {
+			return nil, fmt.Errorf("notification %s: %w", notification.Method, err)
+		}
+	}
+	for _, strct := range model.Structures {
+		for _, prop := range strct.Properties {
+			if err := prop.Type.prepare(); err != nil {
+				return nil, fmt.Errorf("structure %s property %s: %w", strct.Name, prop.Name, err)
+			}
+		}
+	}
+	for _, alias := range model.TypeAliases {
+		if err := alias.Type.prepare(); err != nil {
+			return nil, fmt.Errorf("type alias %s: %w", alias.Name, err)
+		}
+	}
+	return &model, nil
+}
+
+// prepare unmarshals the parameter types and prepares all types of the method.
+func (m *method) prepare() error {
+	if len(m.Params) > 0 {
+		if m.Params[0] == '[' {
+			if err := json.Unmarshal(m.Params, &m.paramTypes); err != nil {
+				return fmt.Errorf("unmarshal params: %w", err)
+			}
+		} else {
+			var params lspType
+			if err := json.Unmarshal(m.Params, &params); err != nil {
+				return fmt.Errorf("unmarshal params: %w", err)
+			}
+			m.paramTypes = []*lspType{&params}
+		}
+	}
+	for _, param := range m.paramTypes {
+		if err := param.prepare(); err != nil {
+			return fmt.Errorf("params: %w", err)
+		}
+	}
+	if m.Result != nil {
+		if err := m.Result.prepare(); err != nil {
+			return fmt.Errorf("result: %w", err)
+		}
+	}
+	return nil
+}
+
+// prepare unmarshals the Value field according to the Kind and prepares any nested types.
+func (t *lspType) prepare() error {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind {
+	case "map":
+		t.valueType = &lspType{}
+		if err := json.Unmarshal(t.Value, t.valueType); err != nil {
+			return fmt.Errorf("unmarshal map value: %w", err)
+		}
+		if err := t.valueType.prepare(); err != nil {
+			return err
+		}
+	case "literal":
+		t.literal = &structure{Name: "literal"}
+		if err := json.Unmarshal(t.Value, t.literal); err != nil {
+			return fmt.Errorf("unmarshal literal: %w", err)
+		}
+		for _, prop := range t.literal.Properties {
+			if err := prop.Type.prepare(); err != nil {
+				return fmt.Errorf("literal property %s: %w", prop.Name, err)
+			}
+		}
+		t.literal.all = t.literal.Properties
+	case "stringLiteral", "integerLiteral", "booleanLiteral":
+		if err := json.Unmarshal(t.Value, &t.constant); err != nil {
+			return fmt.Errorf("unmarshal %s: %w", t.Kind, err)
+		}
+	case "array":
+		return t.Element.prepare()
+	case "and", "or", "tuple":
+		for _, item := range t.Items {
+			if err := item.prepare(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// String returns a short description of the type for problem messages.
+func (t *lspType) String() string {
+	switch t.Kind {
+	case "base", "reference":
+		return t.Name
+	case "array":
+		return t.Element.String() + "[]"
+	case "map":
+		return "map of " + t.valueType.String()
+	case "literal":
+		return "object literal"
+	case "stringLiteral", "integerLiteral", "booleanLiteral":
+		return fmt.Sprintf("%v", t.constant)
+	case "and", "or", "tuple":
+		separator := map[string]string{"and": " & ", "or": " | ", "tuple": ", "}[t.Kind]
+		str := ""
+		for i, item := range t.Items {
+			if i > 0 {
+				str += separator
+			}
+			str += item.String()
+		}
+		if t.Kind == "tuple" {
+			return "[" + str + "]"
+		}
+		return str
+	}
+	return t.Kind
+}
@@ -1,5 +1,11 @@
 package data
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type AnyMap map[string]any
 
 func (am AnyMap) HasField(name string) bool {
@@ -31,3 +37,107 @@ func (am AnyMap) GetStringField(name string) (string, bool) {
 	}
 	return "", false
 }
+
+// GetPath returns the item at the specified dot-separated path within nested maps and arrays.
+// Array elements are specified by index, for example "result.items.0.label".
+func (am AnyMap) GetPath(path string) (any, bool) {
+	var item any = map[string]any(am)
+	var found bool
+	for _, key := range strings.Split(path, ".") {
+		switch container := item.(type) {
+		case AnyMap:
+			if item, found = container[key]; !found {
+				return nil, false
+			}
+		case map[string]any:
+			if item, found = container[key]; !found {
+				return nil, false
+			}
+		case []any:
+			if index, err := strconv.Atoi(key); err != nil || index < 0 || index >= len(container) {
+				return nil, false
+			} else {
+				item = container[index]
+			}
+		default:
+			return nil, false
+		}
+	}
+	return item, true
+}
+
+// SetPath sets the item at the specified dot-separated path within nested maps and arrays.
+// Missing maps along the path are created, array elements must already exist.
+func (am AnyMap) SetPath(path string, value any) error {
+	keys := strings.Split(path, ".")
+	container, err := am.container(keys[:len(keys)-1], true)
+	if err != nil {
+		return err
+	}
+	key := keys[len(keys)-1]
+	switch container := container.(type) {
+	case map[string]any:
+		container[key] = value
+	case []any:
+		if index, err := strconv.Atoi(key); err != nil || index < 0 || index >= len(container) {
+			return fmt.Errorf("no array element %s in %s", key, path)
+		} else {
+			container[index] = value
+		}
+	default:
+		return fmt.Errorf("no container for %s", path)
+	}
+	return nil
+}
+
+// DeletePath removes the map item at the specified dot-separated path within nested maps and arrays.
+// Returns false if there was no map item at the path.
+func (am AnyMap) DeletePath(path string) bool {
+	keys := strings.Split(path, ".")
+	container, err := am.container(keys[:len(keys)-1], false)
+	if err != nil {
+		return false
+	}
+	if object, ok := container.(map[string]any); ok {
+		if _, found := object[keys[len(keys)-1]]; found {
+			delete(object, keys[len(keys)-1])
+			return true
+		}
+	}
+	return false
+}
+
+// container returns the map or array at the specified keys, optionally creating missing maps.
+func (am AnyMap) container(keys []string, create bool) (any, error) {
+	var item any = map[string]any(am)
+	for i, key := range keys {
+		switch container := plain(item).(type) {
+		case map[string]any:
+			var found bool
+			if item, found = container[key]; !found || item == nil {
+				if !create {
+					return nil, fmt.Errorf("no field %s", strings.Join(keys[:i+1], "."))
+				}
+				item = make(map[string]any)
+				container[key] = item
+			}
+		case []any:
+			if index, err := strconv.Atoi(key); err != nil || index < 0 || index >= len(container) {
+				return nil, fmt.Errorf("no array element %s", strings.Join(keys[:i+1], "."))
+			} else {
+				item = container[index]
+			}
+		default:
+			return nil, fmt.Errorf("%s is not a map or array", strings.Join(keys[:i], "."))
+		}
+	}
+	return plain(item), nil
+}
+
+// plain returns an AnyMap as a plain map so that both can be handled the same way.
+func plain(item any) any {
+	if am, ok := item.(AnyMap); ok {
+		return map[string]any(am)
+	}
+	return item
+}
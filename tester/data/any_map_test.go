@@ -0,0 +1,100 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMap() AnyMap {
+	return AnyMap{
+		"id": float64(1),
+		"result": map[string]any{
+			"items": []any{
+				map[string]any{"label": "first"},
+				AnyMap{"label": "second"},
+			},
+			"empty": nil,
+		},
+	}
+}
+
+func TestAnyMap_GetPath(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		path  string
+		value any
+		found bool
+	}{
+		{name: "top", path: "id", value: float64(1), found: true},
+		{name: "nested", path: "result.items.0.label", value: "first", found: true},
+		{name: "nested AnyMap", path: "result.items.1.label", value: "second", found: true},
+		{name: "nil value", path: "result.empty", value: nil, found: true},
+		{name: "missing", path: "result.missing", found: false},
+		{name: "bad index", path: "result.items.x", found: false},
+		{name: "index too big", path: "result.items.2", found: false},
+		{name: "negative index", path: "result.items.-1", found: false},
+		{name: "not a container", path: "id.value", found: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			value, found := testMap().GetPath(test.path)
+			assert.Equal(t, test.found, found)
+			assert.Equal(t, test.value, value)
+		})
+	}
+}
+
+func TestAnyMap_SetPath(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		path  string
+		value any
+		err   bool
+	}{
+		{name: "replace", path: "id", value: "x"},
+		{name: "add", path: "result.total", value: float64(2)},
+		{name: "array element", path: "result.items.0", value: "replaced"},
+		{name: "in array element", path: "result.items.1.label", value: "changed"},
+		{name: "create maps", path: "params.textDocument.uri", value: "file:///a.go"},
+		{name: "replace nil", path: "result.empty.field", value: true},
+		{name: "bad index", path: "result.items.5", err: true},
+		{name: "bad index along path", path: "result.items.5.label", err: true},
+		{name: "not a container", path: "id.value", err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			am := testMap()
+			err := am.SetPath(test.path, test.value)
+			if test.err {
+				assert.Error(t, err)
+				assert.Equal(t, testMap(), am)
+				return
+			}
+			assert.NoError(t, err)
+			value, found := am.GetPath(test.path)
+			assert.True(t, found)
+			assert.Equal(t, test.value, value)
+		})
+	}
+}
+
+func TestAnyMap_DeletePath(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		path    string
+		deleted bool
+	}{
+		{name: "top", path: "id", deleted: true},
+		{name: "nested", path: "result.empty", deleted: true},
+		{name: "in array element", path: "result.items.1.label", deleted: true},
+		{name: "missing", path: "result.missing", deleted: false},
+		{name: "missing along path", path: "params.textDocument", deleted: false},
+		{name: "array element", path: "result.items.0", deleted: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			am := testMap()
+			assert.Equal(t, test.deleted, am.DeletePath(test.path))
+			_, found := am.GetPath(test.path)
+			assert.Equal(t, test.path == "result.items.0", found)
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package fault
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+var _ lsp.Faulter = (*Injector)(nil)
+
+// Injector applies faults to messages passing between client and server in Nexus mode.
+// Faults are applied in the following order:
+//   - the destination connection may be closed instead of sending the message,
+//   - the message may be dropped,
+//   - the message may be delayed,
+//   - the message may be held until enough messages are available to be reordered, and
+//   - the message frame may be corrupted when it is finally sent.
+type Injector struct {
+	logger   *zerolog.Logger
+	settings Settings
+	delays   []*delay
+	reorder  map[string]*reorderBuffer
+	lock     sync.Mutex
+}
+
+// Settings control the faults applied by an Injector.
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// Delay specifies message delays by method (e.g. "textDocument/hover=500ms,*=10ms-50ms").
+	Delay string `json:"delay"`
+	// Drop is the probability that a message is dropped.
+	Drop float64 `json:"drop"`
+	// Reorder is the number of messages in each direction that are shuffled before being sent.
+	Reorder int `json:"reorder"`
+	// Corrupt is the probability that a message frame is corrupted.
+	Corrupt float64 `json:"corrupt"`
+	// Close is the probability that the destination connection is closed instead of sending a message.
+	Close float64 `json:"close"`
+}
+
+// delay is a fixed or random delay for a method.
+type delay struct {
+	method   string
+	min, max time.Duration
+}
+
+// anyMethod is the method name in a delay specification that matches all messages.
+const anyMethod = "*"
+
+// reorderWait is the maximum time a message is held for reordering.
+// This keeps messages from being held forever when no more messages are coming.
+const reorderWait = 250 * time.Millisecond
+
+type reorderBuffer struct {
+	items []*reorderItem
+	timer *time.Timer
+}
+
+type reorderItem struct {
+	content []byte
+	link    lsp.Link
+}
+
+func NewInjector(flags *flags.Set) (*Injector, error) {
+	logger := log.With().Str("svc", "fault").Logger()
+	injector := &Injector{
+		logger:  &logger,
+		reorder: make(map[string]*reorderBuffer),
+	}
+	if err := injector.SetSettings(Settings{
+		Enabled: flags.Faults(),
+		Delay:   flags.FaultDelay(),
+		Drop:    flags.FaultDrop(),
+		Reorder: flags.FaultReorder(),
+		Corrupt: flags.FaultCorrupt(),
+		Close:   flags.FaultClose(),
+	}); err != nil {
+		return nil, err
+	}
+	return injector, nil
+}
+
+// Settings returns a copy of the current settings.
+func (i *Injector) Settings() Settings {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.settings
+}
+
+// SetSettings changes the settings after checking them.
+// Messages held for reordering are sent if reordering is turned off.
+func (i *Injector) SetSettings(settings Settings) error {
+	delays, err := parseDelays(settings.Delay)
+	if err != nil {
+		return fmt.Errorf("parse delay: %w", err)
+	}
+	for name, probability := range map[string]float64{
+		"drop":    settings.Drop,
+		"corrupt": settings.Corrupt,
+		"close":   settings.Close,
+	} {
+		if probability < 0 || probability > 1 {
+			return fmt.Errorf("%s probability %g is not between 0 and 1", name, probability)
+		}
+	}
+	if settings.Reorder < 0 {
+		return fmt.Errorf("reorder window %d is negative", settings.Reorder)
+	}
+
+	i.lock.Lock()
+	i.settings = settings
+	i.delays = delays
+	var flush []string
+	if !settings.Enabled || settings.Reorder < 2 {
+		for from := range i.reorder {
+			flush = append(flush, from)
+		}
+	}
+	i.lock.Unlock()
+
+	for _, from := range flush {
+		i.flush(from)
+	}
+	i.logger.Info().Bool("enabled", settings.Enabled).Str("delay", settings.Delay).
+		Float64("drop", settings.Drop).Int("reorder", settings.Reorder).
+		Float64("corrupt", settings.Corrupt).Float64("close", settings.Close).Msg("Settings")
+	return nil
+}
+
+// Fault sends the content received from the named Receiver via the Link after applying faults.
+func (i *Injector) Fault(from string, content []byte, link lsp.Link) {
+	i.lock.Lock()
+	settings := i.settings
+	delays := i.delays
+	i.lock.Unlock()
+
+	if !settings.Enabled {
+		i.forward(content, link)
+		return
+	}
+
+	var fields struct {
+		Method string `json:"method"`
+	}
+	_ = json.Unmarshal(content, &fields)
+	logger := i.logger.With().Str("from", from).Str("method", fields.Method).Logger()
+
+	if settings.Close > 0 && rand.Float64() < settings.Close {
+		logger.Warn().Msg("Close connection")
+		if err := link.Close(); err != nil {
+			logger.Error().Err(err).Msg("Close connection")
+		}
+		return
+	}
+	if settings.Drop > 0 && rand.Float64() < settings.Drop {
+		logger.Warn().Int("size", len(content)).Msg("Drop message")
+		return
+	}
+
+	content = append([]byte{}, content...)
+	deliver := func() {
+		if settings.Reorder > 1 {
+			i.hold(from, settings.Reorder, &reorderItem{content: content, link: link})
+		} else {
+			i.send(content, link)
+		}
+	}
+	if wait := delayFor(delays, fields.Method); wait > 0 {
+		logger.Debug().Dur("delay", wait).Msg("Delay message")
+		time.AfterFunc(wait, deliver)
+	} else {
+		deliver()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// hold adds the item to the reorder buffer for the named Receiver.
+// When the buffer is full the items in it are sent in random order.
+func (i *Injector) hold(from string, window int, item *reorderItem) {
+	i.lock.Lock()
+	buffer, found := i.reorder[from]
+	if !found {
+		buffer = &reorderBuffer{}
+		i.reorder[from] = buffer
+	}
+	buffer.items = append(buffer.items, item)
+	full := len(buffer.items) >= window
+	if !full && buffer.timer == nil {
+		buffer.timer = time.AfterFunc(reorderWait, func() { i.flush(from) })
+	}
+	i.lock.Unlock()
+
+	if full {
+		i.flush(from)
+	}
+}
+
+// flush sends all items in the reorder buffer for the named Receiver in random order.
+func (i *Injector) flush(from string) {
+	i.lock.Lock()
+	buffer, found := i.reorder[from]
+	if found {
+		delete(i.reorder, from)
+		if buffer.timer != nil {
+			buffer.timer.Stop()
+		}
+	}
+	i.lock.Unlock()
+
+	if !found {
+		return
+	}
+	rand.Shuffle(len(buffer.items), func(a, b int) {
+		buffer.items[a], buffer.items[b] = buffer.items[b], buffer.items[a]
+	})
+	if len(buffer.items) > 1 {
+		i.logger.Warn().Str("from", from).Int("messages", len(buffer.items)).Msg("Reorder messages")
+	}
+	for _, item := range buffer.items {
+		i.send(item.content, item.link)
+	}
+}
+
+// send forwards the content, possibly with a corrupted frame.
+func (i *Injector) send(content []byte, link lsp.Link) {
+	i.lock.Lock()
+	probability := i.settings.Corrupt
+	if !i.settings.Enabled {
+		probability = 0
+	}
+	i.lock.Unlock()
+
+	if probability > 0 && rand.Float64() < probability {
+		kind, frame := corrupt(content)
+		i.logger.Warn().Str("corruption", kind).Int("size", len(content)).Msg("Corrupt frame")
+		if err := link.WriteFrame(frame); err != nil {
+			i.logger.Error().Err(err).Msg("Write corrupt frame")
+		}
+		return
+	}
+	i.forward(content, link)
+}
+
+func (i *Injector) forward(content []byte, link lsp.Link) {
+	if err := link.Forward(content); err != nil {
+		i.logger.Error().Err(err).Msg("Sending outgoing message")
+	}
+}
+
+// corrupt returns a randomly chosen kind of corruption and the corrupted frame.
+func corrupt(content []byte) (string, []byte) {
+	switch rand.Intn(3) {
+	case 0:
+		// The header is correct but only part of the content is sent.
+		return "truncated", []byte(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(content), content[:len(content)/2]))
+	case 1:
+		return "malformed", []byte(fmt.Sprintf("Content-Length: %dx\r\n\r\n%s", len(content), content))
+	default:
+		// The header claims more content than is sent.
+		return "overlong", []byte(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(content)+16, content))
+	}
+}
+
+// parseDelays parses a delay specification of the form "<method>=<duration>[-<duration>],...".
+// A single duration is a fixed delay, a range is a random delay within the range.
+// The method "*" specifies the delay for messages with no other delay (including responses).
+func parseDelays(spec string) ([]*delay, error) {
+	delays := make([]*delay, 0)
+	if strings.TrimSpace(spec) == "" {
+		return delays, nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		method, durations, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found || method == "" {
+			return nil, fmt.Errorf("delay '%s' not of the form <method>=<duration>", item)
+		}
+		minStr, maxStr, isRange := strings.Cut(durations, "-")
+		d := &delay{method: method}
+		var err error
+		if d.min, err = time.ParseDuration(minStr); err != nil {
+			return nil, fmt.Errorf("parse delay for %s: %w", method, err)
+		}
+		d.max = d.min
+		if isRange {
+			if d.max, err = time.ParseDuration(maxStr); err != nil {
+				return nil, fmt.Errorf("parse delay for %s: %w", method, err)
+			} else if d.max < d.min {
+				return nil, fmt.Errorf("delay range for %s is backwards", method)
+			}
+		}
+		delays = append(delays, d)
+	}
+	return delays, nil
+}
+
+// delayFor returns the delay for the specified method.
+func delayFor(delays []*delay, method string) time.Duration {
+	var match *delay
+	for _, d := range delays {
+		if d.method == method {
+			match = d
+			break
+		} else if d.method == anyMethod && match == nil {
+			match = d
+		}
+	}
+	if match == nil {
+		return 0
+	} else if match.max > match.min {
+		return match.min + time.Duration(rand.Int63n(int64(match.max-match.min)))
+	}
+	return match.min
+}
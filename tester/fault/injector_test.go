@@ -0,0 +1,70 @@
+package fault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDelays(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		spec   string
+		delays []*delay
+		err    bool
+	}{
+		{name: "empty", spec: " ", delays: []*delay{}},
+		{
+			name:   "fixed",
+			spec:   "textDocument/hover=500ms",
+			delays: []*delay{{method: "textDocument/hover", min: 500 * time.Millisecond, max: 500 * time.Millisecond}},
+		},
+		{
+			name: "range and any",
+			spec: "textDocument/hover=1s, *=10ms-50ms",
+			delays: []*delay{
+				{method: "textDocument/hover", min: time.Second, max: time.Second},
+				{method: anyMethod, min: 10 * time.Millisecond, max: 50 * time.Millisecond},
+			},
+		},
+		{name: "no duration", spec: "textDocument/hover", err: true},
+		{name: "no method", spec: "=1s", err: true},
+		{name: "bad duration", spec: "textDocument/hover=soon", err: true},
+		{name: "bad range", spec: "textDocument/hover=1s-later", err: true},
+		{name: "backwards range", spec: "textDocument/hover=1s-10ms", err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			delays, err := parseDelays(test.spec)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.delays, delays)
+		})
+	}
+}
+
+func TestDelayFor(t *testing.T) {
+	delays, err := parseDelays("*=10ms-20ms,textDocument/hover=500ms,textDocument/completion=0s")
+	require.NoError(t, err)
+	for _, test := range []struct {
+		name     string
+		method   string
+		min, max time.Duration
+	}{
+		{name: "fixed", method: "textDocument/hover", min: 500 * time.Millisecond, max: 500 * time.Millisecond},
+		{name: "method after any", method: "textDocument/completion"},
+		{name: "any", method: "textDocument/definition", min: 10 * time.Millisecond, max: 20 * time.Millisecond},
+		{name: "response", method: "", min: 10 * time.Millisecond, max: 20 * time.Millisecond},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := delayFor(delays, test.method)
+			assert.GreaterOrEqual(t, d, test.min)
+			assert.LessOrEqual(t, d, test.max)
+		})
+	}
+	assert.Zero(t, delayFor(nil, "textDocument/hover"))
+}
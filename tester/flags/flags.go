@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/madkins23/go-utils/path"
 	"github.com/rs/zerolog"
@@ -37,6 +38,11 @@ const (
 	// In this mode flags must provide connection data to the LSP.
 	// The required flag must specify the server connection (e.g. -serverPort).
 	Server
+
+	// Replay mode tests the LSP as a server by replaying the client side of a recorded session.
+	// In this mode flags must provide connection data to the LSP and a recorded session (-replay).
+	// Responses from the LSP are compared to the recorded responses.
+	Replay
 )
 
 // Protocol is the LSP communications protocolFlag.
@@ -50,6 +56,34 @@ const (
 
 	// TCP protocol communicates with LSP via TCP ports.
 	TCP
+
+	// Pipe protocol communicates with LSP via Unix domain socket paths.
+	Pipe
+
+	// Reverse protocol runs LSP as sub-process which connects back to a TCP port.
+	Reverse
+)
+
+// NotifyPolicy determines which client(s) are sent server messages
+// that are not responses to client requests when multiple clients are connected.
+//
+//go:generate go run github.com/dmarkham/enumer -type=NotifyPolicy -trimprefix=Notify -text
+type NotifyPolicy uint
+
+const (
+	// NotifyBroadcast sends server notifications to all connected clients.
+	// Server requests are sent to the client that most recently sent a message.
+	NotifyBroadcast NotifyPolicy = iota
+
+	// NotifyFirst sends server notifications and requests to the earliest connected client.
+	NotifyFirst
+
+	// NotifyLast sends server notifications and requests to the latest connected client.
+	NotifyLast
+
+	// NotifyRecent sends server notifications and requests to the client
+	// that most recently sent a message.
+	NotifyRecent
 )
 
 // ErrHelp should be visible without drilling into the original flag package.
@@ -62,13 +96,21 @@ type Set struct {
 	mode          Mode
 	protocolFlag  string
 	protocol      Protocol
+	notifyFlag    string
+	notify        NotifyPolicy
 	hostAddress   string
 	command       string
 	commandPath   string
 	commandArgs   []string
+	stderrFile    string
+	restarts      uint
 	clientPort    uint
 	serverPort    uint
+	clientPipe    string
+	serverPipe    string
+	wsPort        uint
 	webPort       uint
+	historySize   uint
 	messageDir    string
 	requestPath   string
 	maxFieldLen   uint
@@ -81,6 +123,23 @@ type Set struct {
 	logFileLvlStr string
 	logStdFormat  string
 	logMsgTwice   bool
+	recordPath    string
+	replayPath    string
+	replayTiming  bool
+	replayWait    time.Duration
+	mockPath      string
+	rewritePath   string
+	faultDelay    string
+	faultDrop     float64
+	faultReorder  uint
+	faultCorrupt  float64
+	faultClose    float64
+	scenarioPath  string
+	handshake     bool
+	rootURI       string
+	clientName    string
+	capsPath      string
+	metaModelPath string
 	version       bool
 }
 
@@ -90,11 +149,18 @@ func NewSet() *Set {
 	}
 	set.StringVar(&set.modeFlag, "mode", "", "Operating modeFlag")
 	set.StringVar(&set.protocolFlag, "protocol", "", "LSP communication protocol")
+	set.StringVar(&set.notifyFlag, "notify", "broadcast", "Server notification policy for multiple clients")
 	set.StringVar(&set.hostAddress, "host", "127.0.0.1", "Host address")
 	set.StringVar(&set.command, "command", "", "LSP server command")
+	set.StringVar(&set.stderrFile, "stderrFile", "", "File for LSP server command standard error")
+	set.UintVar(&set.restarts, "restarts", 0, "Maximum restarts of crashed LSP server command")
 	set.UintVar(&set.clientPort, "clientPort", 0, "Port number served for extension to contact")
 	set.UintVar(&set.serverPort, "serverPort", 0, "Port number on which to contact LSP server")
+	set.StringVar(&set.clientPipe, "clientPipe", "", "Socket path served for extension to contact")
+	set.StringVar(&set.serverPipe, "serverPipe", "", "Socket path on which to contact LSP server")
+	set.UintVar(&set.wsPort, "wsPort", 0, "WebSocket port number served for browser clients to contact")
 	set.UintVar(&set.webPort, "webPort", 0, "Web port number to enable web access")
+	set.UintVar(&set.historySize, "history", 1000, "Number of messages kept in web history")
 	set.StringVar(&set.messageDir, "messages", "", "Path to directory of message files")
 	set.StringVar(&set.requestPath, "request", "", "Path to requestPath file (client mode)")
 	set.BoolVar(&set.logMsgTwice, "logMsgTwice", false, "Log each message twice with tester in the middle")
@@ -105,6 +171,23 @@ func NewSet() *Set {
 	set.BoolVar(&set.logFileAppend, "fileAppend", false, "Append to any pre-existing log file")
 	set.StringVar(&set.logFileFormat, "fileFormat", logging.FmtDefault, "Log file format")
 	set.StringVar(&set.logFileLvlStr, "fileLevel", "info", "Set log file level")
+	set.StringVar(&set.recordPath, "record", "", "Record messages to JSON Lines file")
+	set.StringVar(&set.replayPath, "replay", "", "Recorded session file to replay (replay mode)")
+	set.BoolVar(&set.replayTiming, "replayTiming", false, "Replay messages with original timing")
+	set.DurationVar(&set.replayWait, "replayWait", 5*time.Second, "Maximum wait for replay responses")
+	set.StringVar(&set.mockPath, "mock", "", "Rules file for mock responses")
+	set.StringVar(&set.rewritePath, "rewrite", "", "Rules file for rewriting messages (nexus mode)")
+	set.StringVar(&set.faultDelay, "faultDelay", "", "Message delays by method (nexus mode)")
+	set.Float64Var(&set.faultDrop, "faultDrop", 0, "Probability of dropping a message (nexus mode)")
+	set.UintVar(&set.faultReorder, "faultReorder", 0, "Window size for reordering messages (nexus mode)")
+	set.Float64Var(&set.faultCorrupt, "faultCorrupt", 0, "Probability of corrupting a message frame (nexus mode)")
+	set.Float64Var(&set.faultClose, "faultClose", 0, "Probability of closing a connection (nexus mode)")
+	set.StringVar(&set.scenarioPath, "scenario", "", "Scenario file to run (client mode)")
+	set.BoolVar(&set.handshake, "handshake", false, "Initialize server before requests (client mode)")
+	set.StringVar(&set.rootURI, "rootUri", "", "Root URI for initialize handshake")
+	set.StringVar(&set.clientName, "clientName", "lsp-tester", "Client name for initialize handshake")
+	set.StringVar(&set.capsPath, "capabilities", "", "Client capabilities file for initialize handshake")
+	set.StringVar(&set.metaModelPath, "metaModel", "", "LSP metaModel.json file for conformance checking")
 	set.BoolVar(&set.version, "version", false, "Show lsp-tester version")
 	return set
 }
@@ -120,10 +203,20 @@ func (s *Set) Validate() error {
 		return fmt.Errorf("check -protocol: %w", err)
 	}
 
+	if err := s.validateNotify(); err != nil {
+		return fmt.Errorf("check -notify: %w", err)
+	}
+
 	if err := s.validateCommand(); err != nil {
 		return fmt.Errorf("check -command: %w", err)
 	}
 
+	if err := s.fixStderrFile(); err != nil {
+		return fmt.Errorf("fix stderr file: %w", err)
+	}
+
+	s.fixRestarts()
+
 	if err := s.fixMessageDirectory(); err != nil {
 		return fmt.Errorf("fix message directory: %w", err)
 	}
@@ -132,6 +225,38 @@ func (s *Set) Validate() error {
 		return fmt.Errorf("fix request path: %w", err)
 	}
 
+	if err := s.fixRecordPath(); err != nil {
+		return fmt.Errorf("fix record path: %w", err)
+	}
+
+	if err := s.fixReplayPath(); err != nil {
+		return fmt.Errorf("fix replay path: %w", err)
+	}
+
+	if err := s.fixMockPath(); err != nil {
+		return fmt.Errorf("fix mock path: %w", err)
+	}
+
+	if err := s.fixRewritePath(); err != nil {
+		return fmt.Errorf("fix rewrite path: %w", err)
+	}
+
+	if err := s.validateFaults(); err != nil {
+		return fmt.Errorf("check faults: %w", err)
+	}
+
+	if err := s.fixScenarioPath(); err != nil {
+		return fmt.Errorf("fix scenario path: %w", err)
+	}
+
+	if err := s.fixHandshake(); err != nil {
+		return fmt.Errorf("fix handshake: %w", err)
+	}
+
+	if err := s.fixMetaModelPath(); err != nil {
+		return fmt.Errorf("fix metaModel path: %w", err)
+	}
+
 	return nil
 
 }
@@ -180,13 +305,17 @@ func (s *Set) ModeConnectsToClient() bool {
 }
 
 func (s *Set) ModeConnectsToServer() bool {
-	return s.mode == Client || s.mode == Nexus
+	return s.mode == Client || s.mode == Nexus || s.mode == Replay
 }
 
 func (s *Set) Protocol() Protocol {
 	return s.protocol
 }
 
+func (s *Set) NotifyPolicy() NotifyPolicy {
+	return s.notify
+}
+
 func (s *Set) HasCommand() bool {
 	return s.command != ""
 }
@@ -199,10 +328,24 @@ func (s *Set) CommandArgs() string {
 	return s.command
 }
 
+func (s *Set) StderrFile() string {
+	return s.stderrFile
+}
+
+// Restarts returns the maximum number of times a crashed LSP server command is restarted.
+// Zero means the command is never restarted.
+func (s *Set) Restarts() uint {
+	return s.restarts
+}
+
 func (s *Set) ClientPort() uint {
 	return s.clientPort
 }
 
+func (s *Set) ClientPipe() string {
+	return s.clientPipe
+}
+
 func (s *Set) HostAddress() string {
 	return s.hostAddress
 }
@@ -239,10 +382,22 @@ func (s *Set) ServerPort() int {
 	return int(s.serverPort)
 }
 
+func (s *Set) ServerPipe() string {
+	return s.serverPipe
+}
+
+func (s *Set) WebSocketPort() uint {
+	return s.wsPort
+}
+
 func (s *Set) WebPort() uint {
 	return s.webPort
 }
 
+func (s *Set) HistorySize() int {
+	return int(s.historySize)
+}
+
 func (s *Set) MessageDir() string {
 	return s.messageDir
 }
@@ -255,6 +410,79 @@ func (s *Set) LogMessageTwice() bool {
 	return s.logMsgTwice
 }
 
+func (s *Set) RecordPath() string {
+	return s.recordPath
+}
+
+func (s *Set) MockPath() string {
+	return s.mockPath
+}
+
+func (s *Set) RewritePath() string {
+	return s.rewritePath
+}
+
+// Faults returns true if any fault injection flags are set.
+func (s *Set) Faults() bool {
+	return s.faultDelay != "" || s.faultDrop > 0 || s.faultReorder > 1 || s.faultCorrupt > 0 || s.faultClose > 0
+}
+
+func (s *Set) FaultDelay() string {
+	return s.faultDelay
+}
+
+func (s *Set) FaultDrop() float64 {
+	return s.faultDrop
+}
+
+func (s *Set) FaultReorder() int {
+	return int(s.faultReorder)
+}
+
+func (s *Set) FaultCorrupt() float64 {
+	return s.faultCorrupt
+}
+
+func (s *Set) FaultClose() float64 {
+	return s.faultClose
+}
+
+func (s *Set) ScenarioPath() string {
+	return s.scenarioPath
+}
+
+func (s *Set) Handshake() bool {
+	return s.handshake
+}
+
+func (s *Set) RootURI() string {
+	return s.rootURI
+}
+
+func (s *Set) ClientName() string {
+	return s.clientName
+}
+
+func (s *Set) CapabilitiesPath() string {
+	return s.capsPath
+}
+
+func (s *Set) MetaModelPath() string {
+	return s.metaModelPath
+}
+
+func (s *Set) ReplayPath() string {
+	return s.replayPath
+}
+
+func (s *Set) ReplayTiming() bool {
+	return s.replayTiming
+}
+
+func (s *Set) ReplayWait() time.Duration {
+	return s.replayWait
+}
+
 func (s *Set) fixLogFilePath() error {
 	if s.logFilePath != "" {
 		var err error
@@ -271,6 +499,161 @@ func (s *Set) fixLogFilePath() error {
 	return nil
 }
 
+func (s *Set) fixRecordPath() error {
+	if s.recordPath != "" {
+		var err error
+		if s.recordPath, err = path.FixHomePath(s.recordPath); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.recordPath, err)
+		}
+		recordPathDir := filepath.Dir(s.recordPath)
+		if stat, err := os.Stat(recordPathDir); err != nil {
+			return fmt.Errorf("verify existence of record path directory: %w", err)
+		} else if !stat.IsDir() {
+			return fmt.Errorf("record path directory %s not a directory", recordPathDir)
+		}
+	}
+	return nil
+}
+
+func (s *Set) fixReplayPath() error {
+	if s.mode == Replay && s.replayPath == "" {
+		return errors.New("no -replay file for replay mode")
+	} else if s.replayPath != "" {
+		var err error
+		if s.replayPath, err = path.FixHomePath(s.replayPath); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.replayPath, err)
+		}
+		if stat, err := os.Stat(s.replayPath); err != nil {
+			return fmt.Errorf("verify existence of replay file: %w", err)
+		} else if stat.IsDir() {
+			return fmt.Errorf("-replay %s is a directory", s.replayPath)
+		}
+	}
+	return nil
+}
+
+func (s *Set) fixMockPath() error {
+	if s.mockPath != "" {
+		if s.mode != Server && s.mode != Client {
+			log.Warn().Msgf("-mock will be ignored in %s mode", s.mode)
+		}
+		var err error
+		if s.mockPath, err = path.FixHomePath(s.mockPath); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.mockPath, err)
+		}
+		if stat, err := os.Stat(s.mockPath); err != nil {
+			return fmt.Errorf("verify existence of mock rules file: %w", err)
+		} else if stat.IsDir() {
+			return fmt.Errorf("-mock %s is a directory", s.mockPath)
+		}
+	}
+	return nil
+}
+
+func (s *Set) fixStderrFile() error {
+	if s.stderrFile != "" {
+		if s.Protocol() != Sub && s.Protocol() != Reverse {
+			log.Warn().Msgf("-stderrFile will be ignored in %s protocol", s.Protocol())
+		}
+		var err error
+		if s.stderrFile, err = path.FixHomePath(s.stderrFile); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.stderrFile, err)
+		}
+	}
+	return nil
+}
+
+func (s *Set) fixRestarts() {
+	if s.restarts > 0 && s.Protocol() != Sub {
+		log.Warn().Msgf("-restarts will be ignored in %s protocol", s.Protocol())
+	}
+}
+
+func (s *Set) fixRewritePath() error {
+	if s.rewritePath != "" {
+		if s.mode != Nexus {
+			log.Warn().Msgf("-rewrite will be ignored in %s mode", s.mode)
+		}
+		var err error
+		if s.rewritePath, err = path.FixHomePath(s.rewritePath); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.rewritePath, err)
+		}
+		if stat, err := os.Stat(s.rewritePath); err != nil {
+			return fmt.Errorf("verify existence of rewrite rules file: %w", err)
+		} else if stat.IsDir() {
+			return fmt.Errorf("-rewrite %s is a directory", s.rewritePath)
+		}
+	}
+	return nil
+}
+
+func (s *Set) validateFaults() error {
+	if s.Faults() && s.mode != Nexus {
+		log.Warn().Msgf("-fault flags will be ignored in %s mode", s.mode)
+	}
+	for name, probability := range map[string]float64{
+		"-faultDrop":    s.faultDrop,
+		"-faultCorrupt": s.faultCorrupt,
+		"-faultClose":   s.faultClose,
+	} {
+		if probability < 0 || probability > 1 {
+			return fmt.Errorf("%s %g is not between 0 and 1", name, probability)
+		}
+	}
+	return nil
+}
+
+func (s *Set) fixScenarioPath() error {
+	if s.scenarioPath != "" {
+		if s.mode != Client {
+			return fmt.Errorf("-scenario not supported in %s mode", s.mode)
+		}
+		var err error
+		if s.scenarioPath, err = path.FixHomePath(s.scenarioPath); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.scenarioPath, err)
+		}
+		if stat, err := os.Stat(s.scenarioPath); err != nil {
+			return fmt.Errorf("verify existence of scenario file: %w", err)
+		} else if stat.IsDir() {
+			return fmt.Errorf("-scenario %s is a directory", s.scenarioPath)
+		}
+	}
+	return nil
+}
+
+func (s *Set) fixHandshake() error {
+	if s.handshake && s.mode != Client {
+		return fmt.Errorf("-handshake not supported in %s mode", s.mode)
+	}
+	if s.capsPath != "" {
+		var err error
+		if s.capsPath, err = path.FixHomePath(s.capsPath); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.capsPath, err)
+		}
+		if stat, err := os.Stat(s.capsPath); err != nil {
+			return fmt.Errorf("verify existence of capabilities file: %w", err)
+		} else if stat.IsDir() {
+			return fmt.Errorf("-capabilities %s is a directory", s.capsPath)
+		}
+	}
+	return nil
+}
+
+func (s *Set) fixMetaModelPath() error {
+	if s.metaModelPath != "" {
+		var err error
+		if s.metaModelPath, err = path.FixHomePath(s.metaModelPath); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.metaModelPath, err)
+		}
+		if stat, err := os.Stat(s.metaModelPath); err != nil {
+			return fmt.Errorf("verify existence of metaModel file: %w", err)
+		} else if stat.IsDir() {
+			return fmt.Errorf("-metaModel %s is a directory", s.metaModelPath)
+		}
+	}
+	return nil
+}
+
 func (s *Set) fixMessageDirectory() error {
 	if s.messageDir != "" {
 		// Clean up and verify the message directory path.
@@ -364,12 +747,16 @@ func (s *Set) validateMode() error {
 	var err error
 	if s.modeFlag == "" {
 		// Try to guess mode from other flags.
-		if s.serverPort != 0 && s.clientPort != 0 {
+		if s.replayPath != "" {
+			s.mode = Replay
+		} else if s.hasServerFlag() && s.hasClientFlag() {
 			s.mode = Nexus
-		} else if s.serverPort != 0 {
+		} else if s.hasServerFlag() {
 			s.mode = Client
-		} else if s.clientPort != 0 {
+		} else if s.hasClientFlag() {
 			s.mode = Server
+		} else if s.scenarioPath != "" {
+			s.mode = Client
 		} else {
 			return errors.New("can't guess -mode")
 		}
@@ -380,6 +767,14 @@ func (s *Set) validateMode() error {
 	return nil
 }
 
+func (s *Set) validateNotify() error {
+	var err error
+	if s.notify, err = NotifyPolicyString(s.notifyFlag); err != nil {
+		return fmt.Errorf("parse -notify flag '%s': %w", s.notifyFlag, err)
+	}
+	return nil
+}
+
 func (s *Set) validateProtocol() error {
 	if !s.modeChecked {
 		return fmt.Errorf("validateMode() must be called before validateProtocol()")
@@ -389,7 +784,9 @@ func (s *Set) validateProtocol() error {
 		// Try to guess the protocol from other flags.
 		if s.command != "" {
 			s.protocol = Sub
-		} else if s.serverPort != 0 || s.clientPort != 0 {
+		} else if s.serverPipe != "" || s.clientPipe != "" {
+			s.protocol = Pipe
+		} else if s.serverPort != 0 || s.clientPort != 0 || s.wsPort != 0 {
 			s.protocol = TCP
 		} else {
 			return errors.New("can't guess -protocol")
@@ -397,6 +794,9 @@ func (s *Set) validateProtocol() error {
 	} else if s.protocol, err = ProtocolString(s.protocolFlag); err != nil {
 		return fmt.Errorf("parse -protocol flag '%s': %w", s.protocolFlag, err)
 	}
+	if s.WebSocketPort() != 0 && !s.ModeConnectsToClient() {
+		log.Warn().Msgf("-wsPort will be ignored in %s mode", s.Mode())
+	}
 	switch s.protocol {
 	case Sub:
 		if s.ModeConnectsToServer() && !s.HasCommand() {
@@ -409,7 +809,7 @@ func (s *Set) validateProtocol() error {
 			log.Warn().Msg("-serverPort will be ignored in Sub protocol")
 		}
 	case TCP:
-		if s.ModeConnectsToClient() && s.ClientPort() == 0 {
+		if s.ModeConnectsToClient() && s.ClientPort() == 0 && s.WebSocketPort() == 0 {
 			return fmt.Errorf("no -clientPort for TCP/%s", s.Mode())
 		}
 		if s.ModeConnectsToServer() && s.ServerPort() == 0 {
@@ -418,6 +818,43 @@ func (s *Set) validateProtocol() error {
 		if s.HasCommand() {
 			log.Warn().Msg("-command will be ignored in TCP Protocol")
 		}
+	case Reverse:
+		if !s.ModeConnectsToServer() {
+			return fmt.Errorf("no server connection for Reverse/%s", s.Mode())
+		}
+		if !s.HasCommand() {
+			return fmt.Errorf("no -command for Reverse/%s", s.Mode())
+		}
+		if s.ModeConnectsToClient() && s.ClientPort() == 0 && s.WebSocketPort() == 0 {
+			return fmt.Errorf("no -clientPort for Reverse/%s", s.Mode())
+		}
+	case Pipe:
+		if s.ModeConnectsToClient() && s.ClientPipe() == "" && s.WebSocketPort() == 0 {
+			return fmt.Errorf("no -clientPipe for Pipe/%s", s.Mode())
+		}
+		if s.ModeConnectsToServer() && s.ServerPipe() == "" {
+			return fmt.Errorf("no -serverPipe for Pipe/%s", s.Mode())
+		}
+		if s.HasCommand() {
+			log.Warn().Msg("-command will be ignored in Pipe Protocol")
+		}
+		var err error
+		if s.clientPipe, err = path.FixHomePath(s.clientPipe); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.clientPipe, err)
+		}
+		if s.serverPipe, err = path.FixHomePath(s.serverPipe); err != nil {
+			return fmt.Errorf("fix home path '%s': %w", s.serverPipe, err)
+		}
 	}
 	return nil
 }
+
+// hasClientFlag returns true if a flag specifies the client connection.
+func (s *Set) hasClientFlag() bool {
+	return s.clientPort != 0 || s.clientPipe != "" || s.wsPort != 0
+}
+
+// hasServerFlag returns true if a flag specifies the server connection.
+func (s *Set) hasServerFlag() bool {
+	return s.serverPort != 0 || s.serverPipe != ""
+}
@@ -7,11 +7,11 @@ import (
 	"strings"
 )
 
-const _ModeName = "ClientNexusServer"
+const _ModeName = "ClientNexusServerReplay"
 
-var _ModeIndex = [...]uint8{0, 6, 11, 17}
+var _ModeIndex = [...]uint8{0, 6, 11, 17, 23}
 
-const _ModeLowerName = "clientnexusserver"
+const _ModeLowerName = "clientnexusserverreplay"
 
 func (i Mode) String() string {
 	if i >= Mode(len(_ModeIndex)-1) {
@@ -27,9 +27,10 @@ func _ModeNoOp() {
 	_ = x[Client-(0)]
 	_ = x[Nexus-(1)]
 	_ = x[Server-(2)]
+	_ = x[Replay-(3)]
 }
 
-var _ModeValues = []Mode{Client, Nexus, Server}
+var _ModeValues = []Mode{Client, Nexus, Server, Replay}
 
 var _ModeNameToValueMap = map[string]Mode{
 	_ModeName[0:6]:        Client,
@@ -38,12 +39,15 @@ var _ModeNameToValueMap = map[string]Mode{
 	_ModeLowerName[6:11]:  Nexus,
 	_ModeName[11:17]:      Server,
 	_ModeLowerName[11:17]: Server,
+	_ModeName[17:23]:      Replay,
+	_ModeLowerName[17:23]: Replay,
 }
 
 var _ModeNames = []string{
 	_ModeName[0:6],
 	_ModeName[6:11],
 	_ModeName[11:17],
+	_ModeName[17:23],
 }
 
 // ModeString retrieves an enum value from the enum constants string name.
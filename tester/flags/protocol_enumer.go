@@ -7,11 +7,11 @@ import (
 	"strings"
 )
 
-const _ProtocolName = "SubTCP"
+const _ProtocolName = "SubTCPPipeReverse"
 
-var _ProtocolIndex = [...]uint8{0, 3, 6}
+var _ProtocolIndex = [...]uint8{0, 3, 6, 10, 17}
 
-const _ProtocolLowerName = "subtcp"
+const _ProtocolLowerName = "subtcppipereverse"
 
 func (i Protocol) String() string {
 	if i >= Protocol(len(_ProtocolIndex)-1) {
@@ -26,20 +26,28 @@ func _ProtocolNoOp() {
 	var x [1]struct{}
 	_ = x[Sub-(0)]
 	_ = x[TCP-(1)]
+	_ = x[Pipe-(2)]
+	_ = x[Reverse-(3)]
 }
 
-var _ProtocolValues = []Protocol{Sub, TCP}
+var _ProtocolValues = []Protocol{Sub, TCP, Pipe, Reverse}
 
 var _ProtocolNameToValueMap = map[string]Protocol{
-	_ProtocolName[0:3]:      Sub,
-	_ProtocolLowerName[0:3]: Sub,
-	_ProtocolName[3:6]:      TCP,
-	_ProtocolLowerName[3:6]: TCP,
+	_ProtocolName[0:3]:        Sub,
+	_ProtocolLowerName[0:3]:   Sub,
+	_ProtocolName[3:6]:        TCP,
+	_ProtocolLowerName[3:6]:   TCP,
+	_ProtocolName[6:10]:       Pipe,
+	_ProtocolLowerName[6:10]:  Pipe,
+	_ProtocolName[10:17]:      Reverse,
+	_ProtocolLowerName[10:17]: Reverse,
 }
 
 var _ProtocolNames = []string{
 	_ProtocolName[0:3],
 	_ProtocolName[3:6],
+	_ProtocolName[6:10],
+	_ProtocolName[10:17],
 }
 
 // ProtocolString retrieves an enum value from the enum constants string name.
@@ -0,0 +1,242 @@
+package intercept
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+var _ lsp.Interceptor = (*Interceptor)(nil)
+
+// Interceptor holds messages forwarded between Receivers that match a Breakpoint.
+// Held messages may be edited, forwarded, duplicated, or dropped.
+// Messages that don't match any Breakpoint are forwarded immediately,
+// so they may pass messages that are being held.
+type Interceptor struct {
+	logger      *zerolog.Logger
+	breakpoints []*Breakpoint
+	held        map[uint64]*Held
+	nextBP      uint64
+	nextHeld    uint64
+	lock        sync.Mutex
+}
+
+// Breakpoint specifies messages to be held.
+// Empty fields are not used, a Breakpoint with no fields matches all messages.
+type Breakpoint struct {
+	ID     uint64 `json:"id"`
+	Method string `json:"method,omitempty"`
+	// Direction is message.ToServer or message.ToClient.
+	Direction string `json:"direction,omitempty"`
+	// Path is a dotted path to a JSON field (e.g. "params.position.line").
+	// Array elements are specified by index (e.g. "params.contentChanges.0.text").
+	Path string `json:"path,omitempty"`
+	// Value is compared to the field at the Path if specified.
+	// If there is no Value the field need only be present.
+	Value string `json:"value,omitempty"`
+}
+
+// Held is a message being held by the Interceptor.
+type Held struct {
+	ID         uint64    `json:"id"`
+	Time       time.Time `json:"time"`
+	From       string    `json:"from"`
+	Direction  string    `json:"direction"`
+	Method     string    `json:"method,omitempty"`
+	Breakpoint uint64    `json:"breakpoint"`
+	Content    []byte    `json:"-"`
+	forward    func(content []byte) error
+}
+
+func NewInterceptor() *Interceptor {
+	logger := log.With().Str("svc", "intercept").Logger()
+	return &Interceptor{
+		logger: &logger,
+		held:   make(map[uint64]*Held),
+	}
+}
+
+// Intercept holds the content if it matches a Breakpoint.
+func (i *Interceptor) Intercept(from string, content []byte, forward func(content []byte) error) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if len(i.breakpoints) < 1 {
+		return false
+	}
+
+	direction := message.ToServer
+	if from == "server" {
+		direction = message.ToClient
+	}
+	msg := make(data.AnyMap)
+	if err := json.Unmarshal(content, &msg); err != nil {
+		i.logger.Warn().Err(err).Msg("Unmarshal content")
+		return false
+	}
+	method, _ := msg.GetStringField("method")
+	for _, bp := range i.breakpoints {
+		if bp.matches(direction, method, msg) {
+			i.nextHeld++
+			held := &Held{
+				ID:         i.nextHeld,
+				Time:       time.Now(),
+				From:       from,
+				Direction:  direction,
+				Method:     method,
+				Breakpoint: bp.ID,
+				Content:    append([]byte{}, content...),
+				forward:    forward,
+			}
+			i.held[held.ID] = held
+			i.logger.Info().Uint64("held", held.ID).Uint64("breakpoint", bp.ID).
+				Str("from", from).Str("method", method).Msg("Message held")
+			return true
+		}
+	}
+	return false
+}
+
+// AddBreakpoint adds a Breakpoint and returns its ID.
+func (i *Interceptor) AddBreakpoint(bp *Breakpoint) (uint64, error) {
+	switch bp.Direction {
+	case "", message.ToServer, message.ToClient:
+	default:
+		return 0, fmt.Errorf("unknown direction '%s'", bp.Direction)
+	}
+	if bp.Value != "" && bp.Path == "" {
+		return 0, errors.New("value specified without path")
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.nextBP++
+	bp.ID = i.nextBP
+	i.breakpoints = append(i.breakpoints, bp)
+	return bp.ID, nil
+}
+
+// RemoveBreakpoint removes the Breakpoint with the specified ID.
+// Messages already held by the Breakpoint are still held.
+func (i *Interceptor) RemoveBreakpoint(id uint64) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for index, bp := range i.breakpoints {
+		if bp.ID == id {
+			i.breakpoints = append(i.breakpoints[:index], i.breakpoints[index+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %d", id)
+}
+
+// Breakpoints returns the current breakpoints in the order they were added.
+func (i *Interceptor) Breakpoints() []*Breakpoint {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return append([]*Breakpoint{}, i.breakpoints...)
+}
+
+// Held returns the messages currently held, oldest first.
+func (i *Interceptor) Held() []*Held {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	held := make([]*Held, 0, len(i.held))
+	for _, h := range i.held {
+		held = append(held, h)
+	}
+	sort.Slice(held, func(a, b int) bool { return held[a].ID < held[b].ID })
+	return held
+}
+
+// Forward sends the held message with the specified content and stops holding it.
+// If the content is empty the original message content is sent.
+func (i *Interceptor) Forward(id uint64, content []byte) error {
+	held, err := i.take(id, true)
+	if err != nil {
+		return err
+	}
+	return held.send(content)
+}
+
+// Duplicate sends the held message with the specified content and continues holding it.
+// If the content is empty the original message content is sent.
+func (i *Interceptor) Duplicate(id uint64, content []byte) error {
+	held, err := i.take(id, false)
+	if err != nil {
+		return err
+	}
+	return held.send(content)
+}
+
+// Drop stops holding the message without sending it.
+func (i *Interceptor) Drop(id uint64) error {
+	_, err := i.take(id, true)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// take returns the held message with the specified ID, removing it if requested.
+func (i *Interceptor) take(id uint64, remove bool) (*Held, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	held, found := i.held[id]
+	if !found {
+		return nil, fmt.Errorf("no held message %d", id)
+	}
+	if remove {
+		delete(i.held, id)
+	}
+	return held, nil
+}
+
+func (h *Held) send(content []byte) error {
+	if len(bytes.TrimSpace(content)) < 1 {
+		content = h.Content
+	} else {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, content); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		content = compact.Bytes()
+	}
+	if err := h.forward(content); err != nil {
+		return fmt.Errorf("forward message %d: %w", h.ID, err)
+	}
+	return nil
+}
+
+func (bp *Breakpoint) matches(direction, method string, msg data.AnyMap) bool {
+	if bp.Direction != "" && bp.Direction != direction {
+		return false
+	}
+	if bp.Method != "" && bp.Method != method {
+		return false
+	}
+	if bp.Path != "" {
+		value, found := msg.GetPath(bp.Path)
+		if !found {
+			return false
+		}
+		if bp.Value != "" {
+			if str, ok := value.(string); ok {
+				return str == bp.Value
+			} else if raw, err := json.Marshal(value); err != nil {
+				return false
+			} else {
+				return string(raw) == bp.Value
+			}
+		}
+	}
+	return true
+}
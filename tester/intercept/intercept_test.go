@@ -0,0 +1,98 @@
+package intercept
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+func TestBreakpoint_Matches(t *testing.T) {
+	msg := make(data.AnyMap)
+	require.NoError(t, json.Unmarshal([]byte(`{"id":1,"method":"textDocument/didChange","params":{
+		"textDocument":{"uri":"file:///a.go","version":3},
+		"contentChanges":[{"text":"x"}]}}`), &msg))
+	for _, test := range []struct {
+		name       string
+		breakpoint *Breakpoint
+		direction  string
+		matches    bool
+	}{
+		{name: "empty", breakpoint: &Breakpoint{}, direction: message.ToServer, matches: true},
+		{name: "direction", breakpoint: &Breakpoint{Direction: message.ToServer}, direction: message.ToServer, matches: true},
+		{name: "wrong direction", breakpoint: &Breakpoint{Direction: message.ToClient}, direction: message.ToServer},
+		{name: "method", breakpoint: &Breakpoint{Method: "textDocument/didChange"}, direction: message.ToServer, matches: true},
+		{name: "wrong method", breakpoint: &Breakpoint{Method: "textDocument/didOpen"}, direction: message.ToServer},
+		{name: "path", breakpoint: &Breakpoint{Path: "params.textDocument.uri"}, direction: message.ToServer, matches: true},
+		{name: "missing path", breakpoint: &Breakpoint{Path: "params.position"}, direction: message.ToServer},
+		{name: "string value", breakpoint: &Breakpoint{Path: "params.textDocument.uri", Value: "file:///a.go"}, direction: message.ToServer, matches: true},
+		{name: "wrong string value", breakpoint: &Breakpoint{Path: "params.textDocument.uri", Value: "file:///b.go"}, direction: message.ToServer},
+		{name: "number value", breakpoint: &Breakpoint{Path: "params.textDocument.version", Value: "3"}, direction: message.ToServer, matches: true},
+		{name: "array element", breakpoint: &Breakpoint{Path: "params.contentChanges.0.text", Value: "x"}, direction: message.ToServer, matches: true},
+		{name: "object value", breakpoint: &Breakpoint{Path: "params.contentChanges.0", Value: `{"text":"x"}`}, direction: message.ToServer, matches: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.matches, test.breakpoint.matches(test.direction, "textDocument/didChange", msg))
+		})
+	}
+}
+
+func TestInterceptor_AddBreakpoint(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		breakpoint *Breakpoint
+		err        bool
+	}{
+		{name: "empty", breakpoint: &Breakpoint{}},
+		{name: "to client", breakpoint: &Breakpoint{Direction: message.ToClient}},
+		{name: "bad direction", breakpoint: &Breakpoint{Direction: "sideways"}, err: true},
+		{name: "value without path", breakpoint: &Breakpoint{Value: "x"}, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := NewInterceptor().AddBreakpoint(test.breakpoint)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, uint64(1), id)
+			}
+		})
+	}
+}
+
+func TestInterceptor_Hold(t *testing.T) {
+	interceptor := NewInterceptor()
+	sent := make([]string, 0)
+	forward := func(content []byte) error {
+		sent = append(sent, string(content))
+		return nil
+	}
+	assert.False(t, interceptor.Intercept("client-1", []byte(`{"method":"exit"}`), forward))
+	bp, err := interceptor.AddBreakpoint(&Breakpoint{Method: "textDocument/hover"})
+	require.NoError(t, err)
+
+	hover := `{"id":1,"method":"textDocument/hover"}`
+	assert.True(t, interceptor.Intercept("client-1", []byte(hover), forward))
+	assert.True(t, interceptor.Intercept("client-1", []byte(hover), forward))
+	assert.False(t, interceptor.Intercept("server", []byte(`{"method":"window/logMessage"}`), forward))
+	held := interceptor.Held()
+	require.Len(t, held, 2)
+	assert.Equal(t, bp, held[0].Breakpoint)
+	assert.Equal(t, message.ToServer, held[0].Direction)
+
+	assert.NoError(t, interceptor.Duplicate(held[0].ID, nil))
+	assert.NoError(t, interceptor.Forward(held[0].ID, []byte("{ \"id\": 2,\n \"method\": \"textDocument/hover\" }")))
+	assert.Error(t, interceptor.Forward(held[0].ID, nil))
+	assert.Error(t, interceptor.Duplicate(held[1].ID, []byte(`{"id":`)))
+	assert.NoError(t, interceptor.Drop(held[1].ID))
+	assert.Empty(t, interceptor.Held())
+	assert.Equal(t, []string{hover, `{"id":2,"method":"textDocument/hover"}`}, sent)
+
+	assert.NoError(t, interceptor.RemoveBreakpoint(bp))
+	assert.Error(t, interceptor.RemoveBreakpoint(bp))
+	assert.False(t, interceptor.Intercept("client-1", []byte(hover), forward))
+}
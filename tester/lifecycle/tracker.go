@@ -0,0 +1,308 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+// State is the lifecycle state of a connection between a client and the server.
+type State int
+
+const (
+	// Uninitialized is the state before the initialize request.
+	Uninitialized State = iota
+	// Initializing is the state after the initialize request until its response.
+	Initializing
+	// Initialized is the state after the initialize response until the initialized notification.
+	Initialized
+	// Running is the state after the initialized notification.
+	Running
+	// ShuttingDown is the state after the shutdown request.
+	ShuttingDown
+	// Exited is the state after the exit notification.
+	Exited
+)
+
+var stateNames = map[State]string{
+	Uninitialized: "uninitialized",
+	Initializing:  "initializing",
+	Initialized:   "initialized",
+	Running:       "running",
+	ShuttingDown:  "shuttingDown",
+	Exited:        "exited",
+}
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+// Rules checked by the Tracker.
+const (
+	RuleBeforeInitialize    = "beforeInitialize"
+	RuleBeforeInitialized   = "beforeInitialized"
+	RuleRepeatedInitialize  = "repeatedInitialize"
+	RuleRepeatedInitialized = "repeatedInitialized"
+	RuleEarlyInitialized    = "earlyInitialized"
+	RuleAfterShutdown       = "afterShutdown"
+	RuleAfterExit           = "afterExit"
+	RuleUnknownResponse     = "unknownResponse"
+	RuleDuplicateID         = "duplicateID"
+	RuleUnknownCancel       = "unknownCancel"
+)
+
+const (
+	cancelRequest = "$/cancelRequest"
+	// maxCompleted is the number of completed request IDs kept per direction
+	// so that late cancellations and duplicate responses can be recognized.
+	maxCompleted = 1000
+)
+
+// earlyServerMethods may be sent by the server before it responds to the initialize request.
+var earlyServerMethods = map[string]bool{
+	"window/showMessage":        true,
+	"window/logMessage":         true,
+	"window/showMessageRequest": true,
+	"telemetry/event":           true,
+	"$/progress":                true,
+	"$/logTrace":                true,
+}
+
+var _ message.Observer = (*Tracker)(nil)
+
+// Tracker follows the LSP lifecycle of each connection between a client and the server
+// and logs violations at error level:
+//
+//   - no requests or notifications before initialize (other than exit),
+//   - initialize only once,
+//   - the initialized notification after the initialize response and before anything else,
+//   - the server only sends window/showMessage and similar messages before the initialize response,
+//   - nothing but exit after shutdown and nothing at all after exit,
+//   - responses only for outstanding request IDs,
+//   - no duplicate IDs for outstanding requests, and
+//   - $/cancelRequest only for IDs of actual requests.
+//
+// Connections are named by message.Entry.Connection.
+type Tracker struct {
+	logger      *zerolog.Logger
+	connections map[string]*connection
+	violations  map[string]uint64
+	lock        sync.Mutex
+}
+
+// Violation counts the violations of a single rule.
+type Violation struct {
+	Rule  string `json:"rule"`
+	Count uint64 `json:"count"`
+}
+
+// connection is the lifecycle state of a single connection.
+type connection struct {
+	name         string
+	state        State
+	initializeID string
+	// pending and completed request IDs by direction (true for requests to the server).
+	pending   map[bool]map[string]string
+	completed map[bool]*recent
+}
+
+// recent is a bounded set of request IDs.
+type recent struct {
+	ids   map[string]bool
+	order []string
+}
+
+func NewTracker() *Tracker {
+	logger := log.With().Str("for", "lifecycle").Logger()
+	return &Tracker{
+		logger:      &logger,
+		connections: make(map[string]*connection),
+		violations:  make(map[string]uint64),
+	}
+}
+
+// Observe advances the lifecycle state of the connection and checks for violations.
+func (t *Tracker) Observe(entry *message.Entry) {
+	name, toServer := entry.Connection()
+	if name == "" {
+		return
+	}
+	fields := entry.Fields()
+	if fields.Type == message.TypeUnknown {
+		return
+	}
+	id := string(fields.ID)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	conn, found := t.connections[name]
+	if !found {
+		conn = &connection{
+			name:      name,
+			pending:   map[bool]map[string]string{true: {}, false: {}},
+			completed: map[bool]*recent{true: newRecent(), false: newRecent()},
+		}
+		t.connections[name] = conn
+	}
+	violate := func(rule, msg string) {
+		t.violations[rule]++
+		event := t.logger.Error().Str("!", entry.Arrow()).Str("connection", name).
+			Str("state", conn.state.String()).Str("rule", rule)
+		if fields.Method != "" {
+			event.Str("method", fields.Method)
+		}
+		if id != "" {
+			event.Str("ID", id)
+		}
+		event.Msg(msg)
+	}
+
+	switch fields.Type {
+	case message.TypeResponse:
+		if _, found := conn.pending[!toServer][id]; found {
+			delete(conn.pending[!toServer], id)
+			conn.completed[!toServer].add(id)
+		} else if conn.completed[!toServer].has(id) {
+			violate(RuleUnknownResponse, "Response to request that already has a response")
+		} else {
+			violate(RuleUnknownResponse, "Response to unknown request ID")
+		}
+		if !toServer && id == conn.initializeID && conn.state == Initializing {
+			if fields.Error {
+				conn.state = Uninitialized
+			} else {
+				conn.state = Initialized
+			}
+		}
+		return
+	case message.TypeRequest:
+		if _, found := conn.pending[toServer][id]; found {
+			violate(RuleDuplicateID, "Request ID already in use by outstanding request")
+		}
+		conn.pending[toServer][id] = fields.Method
+	}
+
+	if fields.Method == cancelRequest {
+		if cancelID := cancelledID(entry.Content); cancelID != "" {
+			if _, found := conn.pending[toServer][cancelID]; !found && !conn.completed[toServer].has(cancelID) {
+				violate(RuleUnknownCancel, "Cancel for unknown request ID "+cancelID)
+			}
+		}
+	}
+
+	if conn.state == Exited {
+		violate(RuleAfterExit, "Message after exit")
+		return
+	}
+	if !toServer {
+		if conn.state < Initialized && !earlyServerMethods[fields.Method] {
+			violate(RuleBeforeInitialize, "Server message before initialize response")
+		}
+		return
+	}
+
+	switch fields.Method {
+	case "initialize":
+		if conn.state != Uninitialized {
+			violate(RuleRepeatedInitialize, "Repeated initialize request")
+		} else {
+			conn.state = Initializing
+			conn.initializeID = id
+		}
+	case "initialized":
+		switch conn.state {
+		case Uninitialized:
+			violate(RuleBeforeInitialize, "Initialized notification before initialize")
+		case Initializing:
+			violate(RuleEarlyInitialized, "Initialized notification before initialize response")
+			conn.state = Running
+		case Initialized:
+			conn.state = Running
+		case Running:
+			violate(RuleRepeatedInitialized, "Repeated initialized notification")
+		case ShuttingDown:
+			violate(RuleAfterShutdown, "Message other than exit after shutdown")
+		}
+	case "exit":
+		conn.state = Exited
+	default:
+		switch conn.state {
+		case Uninitialized:
+			violate(RuleBeforeInitialize, "Message before initialize")
+		case Initializing, Initialized:
+			violate(RuleBeforeInitialized, "Message before initialized notification")
+		case ShuttingDown:
+			violate(RuleAfterShutdown, "Message other than exit after shutdown")
+		}
+		if fields.Method == "shutdown" && conn.state != ShuttingDown {
+			conn.state = ShuttingDown
+		}
+	}
+}
+
+// State returns the lifecycle state of each connection by name.
+func (t *Tracker) State() map[string]State {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	states := make(map[string]State, len(t.connections))
+	for name, conn := range t.connections {
+		states[name] = conn.state
+	}
+	return states
+}
+
+// Violations returns the number of violations of each rule sorted by rule.
+func (t *Tracker) Violations() []*Violation {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	violations := make([]*Violation, 0, len(t.violations))
+	for rule, count := range t.violations {
+		violations = append(violations, &Violation{Rule: rule, Count: count})
+	}
+	sort.Slice(violations, func(i, j int) bool { return violations[i].Rule < violations[j].Rule })
+	return violations
+}
+
+// LogSummary logs the number of violations of each rule.
+func (t *Tracker) LogSummary(logger *zerolog.Logger) {
+	for _, violation := range t.Violations() {
+		logger.Warn().Str("rule", violation.Rule).Uint64("count", violation.Count).Msg("Lifecycle violations")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// cancelledID returns the ID in the params of a $/cancelRequest notification.
+func cancelledID(content []byte) string {
+	var notification struct {
+		Params struct {
+			ID json.RawMessage `json:"id"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(content, &notification); err != nil {
+		return ""
+	}
+	return string(notification.Params.ID)
+}
+
+func newRecent() *recent {
+	return &recent{ids: make(map[string]bool)}
+}
+
+func (r *recent) add(id string) {
+	if len(r.order) >= maxCompleted {
+		delete(r.ids, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.ids[id] = true
+	r.order = append(r.order, id)
+}
+
+func (r *recent) has(id string) bool {
+	return r.ids[id]
+}
@@ -0,0 +1,163 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+const (
+	initialize  = `> {"id":1,"method":"initialize","params":{}}`
+	initResult  = `< {"id":1,"result":{"capabilities":{}}}`
+	initialized = `> {"method":"initialized","params":{}}`
+	shutdown    = `> {"id":9,"method":"shutdown"}`
+	shutResult  = `< {"id":9,"result":null}`
+	exit        = `> {"method":"exit"}`
+)
+
+func TestTracker_Observe(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		messages   []string
+		state      State
+		violations []*Violation
+	}{
+		{name: "initialize", messages: []string{initialize}, state: Initializing},
+		{name: "initialize response", messages: []string{initialize, initResult}, state: Initialized},
+		{
+			name:     "initialize error",
+			messages: []string{initialize, `< {"id":1,"error":{"code":-1,"message":"no"}}`},
+			state:    Uninitialized,
+		},
+		{name: "running", messages: []string{initialize, initResult, initialized}, state: Running},
+		{
+			name:     "full lifecycle",
+			messages: []string{initialize, initResult, initialized, `> {"method":"textDocument/didOpen"}`, shutdown, shutResult, exit},
+			state:    Exited,
+		},
+		{name: "exit without shutdown", messages: []string{initialize, initResult, initialized, exit}, state: Exited},
+		{
+			name:     "early server messages",
+			messages: []string{initialize, `< {"method":"window/logMessage","params":{}}`, initResult},
+			state:    Initialized,
+		},
+		{
+			name:       "server message before initialize response",
+			messages:   []string{initialize, `< {"method":"textDocument/publishDiagnostics","params":{}}`},
+			state:      Initializing,
+			violations: []*Violation{{Rule: RuleBeforeInitialize, Count: 1}},
+		},
+		{
+			name:       "message before initialize",
+			messages:   []string{`> {"id":1,"method":"textDocument/hover"}`},
+			state:      Uninitialized,
+			violations: []*Violation{{Rule: RuleBeforeInitialize, Count: 1}},
+		},
+		{
+			name:       "initialized before initialize",
+			messages:   []string{initialized},
+			state:      Uninitialized,
+			violations: []*Violation{{Rule: RuleBeforeInitialize, Count: 1}},
+		},
+		{
+			name:       "message before initialized",
+			messages:   []string{initialize, initResult, `> {"method":"textDocument/didOpen"}`},
+			state:      Initialized,
+			violations: []*Violation{{Rule: RuleBeforeInitialized, Count: 1}},
+		},
+		{
+			name:       "early initialized",
+			messages:   []string{initialize, initialized, initResult},
+			state:      Running,
+			violations: []*Violation{{Rule: RuleEarlyInitialized, Count: 1}},
+		},
+		{
+			name:       "repeated initialize",
+			messages:   []string{initialize, initResult, initialized, `> {"id":2,"method":"initialize","params":{}}`},
+			state:      Running,
+			violations: []*Violation{{Rule: RuleRepeatedInitialize, Count: 1}},
+		},
+		{
+			name:       "repeated initialized",
+			messages:   []string{initialize, initResult, initialized, initialized},
+			state:      Running,
+			violations: []*Violation{{Rule: RuleRepeatedInitialized, Count: 1}},
+		},
+		{
+			name:       "after shutdown",
+			messages:   []string{initialize, initResult, initialized, shutdown, `> {"method":"textDocument/didOpen"}`},
+			state:      ShuttingDown,
+			violations: []*Violation{{Rule: RuleAfterShutdown, Count: 1}},
+		},
+		{
+			name:       "after exit",
+			messages:   []string{initialize, initResult, initialized, exit, `< {"method":"window/logMessage","params":{}}`},
+			state:      Exited,
+			violations: []*Violation{{Rule: RuleAfterExit, Count: 1}},
+		},
+		{
+			name:       "unknown response",
+			messages:   []string{initialize, initResult, initResult, `< {"id":5,"result":null}`},
+			state:      Initialized,
+			violations: []*Violation{{Rule: RuleUnknownResponse, Count: 2}},
+		},
+		{
+			name:       "duplicate ID",
+			messages:   []string{initialize, initResult, initialized, `> {"id":2,"method":"textDocument/hover"}`, `> {"id":2,"method":"textDocument/hover"}`},
+			state:      Running,
+			violations: []*Violation{{Rule: RuleDuplicateID, Count: 1}},
+		},
+		{
+			name: "cancel",
+			messages: []string{initialize, initResult, initialized,
+				`> {"id":2,"method":"textDocument/hover"}`, `> {"method":"$/cancelRequest","params":{"id":2}}`,
+				`< {"id":2,"result":null}`, `> {"method":"$/cancelRequest","params":{"id":2}}`},
+			state: Running,
+		},
+		{
+			name:       "unknown cancel",
+			messages:   []string{initialize, initResult, initialized, `> {"method":"$/cancelRequest","params":{"id":7}}`},
+			state:      Running,
+			violations: []*Violation{{Rule: RuleUnknownCancel, Count: 1}},
+		},
+		{
+			name: "server request",
+			messages: []string{initialize, initResult, initialized,
+				`< {"id":1,"method":"workspace/configuration","params":{}}`, `> {"id":1,"result":[]}`},
+			state: Running,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := NewTracker()
+			for _, msg := range test.messages {
+				entry := &message.Entry{From: "client-1", To: "server", Content: []byte(msg[2:])}
+				if msg[0] == '<' {
+					entry.From, entry.To = entry.To, entry.From
+				}
+				tracker.Observe(entry)
+			}
+			assert.Equal(t, map[string]State{"client-1": test.state}, tracker.State())
+			if test.violations == nil {
+				test.violations = []*Violation{}
+			}
+			assert.Equal(t, test.violations, tracker.Violations())
+		})
+	}
+}
+
+func TestTracker_Connections(t *testing.T) {
+	tracker := NewTracker()
+	for _, entry := range []*message.Entry{
+		{From: "client-1", To: "server", Content: []byte(initialize[2:])},
+		{From: "client-2", To: "server", Content: []byte(initialize[2:])},
+		{From: "server", To: "client-2", Content: []byte(initResult[2:])},
+		// Messages that are not JSON RPC are ignored.
+		{From: "client-1", To: "server", Content: []byte(`{"jsonrpc":"2.0"}`)},
+	} {
+		tracker.Observe(entry)
+	}
+	assert.Equal(t, map[string]State{"client-1": Initializing, "client-2": Initialized}, tracker.State())
+	assert.Empty(t, tracker.Violations())
+}
@@ -8,6 +8,7 @@ import (
 	"runtime/debug"
 	"sync"
 
+	"github.com/gorilla/websocket"
 	"github.com/madkins23/go-utils/app"
 	"github.com/rs/zerolog/log"
 
@@ -15,17 +16,30 @@ import (
 	utilLog "github.com/madkins23/go-utils/log"
 
 	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+	"github.com/madkins23/lsp-tester/tester/protocol/pipe"
+	"github.com/madkins23/lsp-tester/tester/protocol/reverse"
 	"github.com/madkins23/lsp-tester/tester/protocol/sub"
+	"github.com/madkins23/lsp-tester/tester/protocol/ws"
 
+	"github.com/madkins23/lsp-tester/tester/capability"
+	"github.com/madkins23/lsp-tester/tester/conform"
+	"github.com/madkins23/lsp-tester/tester/fault"
 	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/intercept"
+	"github.com/madkins23/lsp-tester/tester/lifecycle"
 	"github.com/madkins23/lsp-tester/tester/logging"
 	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/mock"
 	"github.com/madkins23/lsp-tester/tester/protocol/tcp"
+	"github.com/madkins23/lsp-tester/tester/replay"
+	"github.com/madkins23/lsp-tester/tester/rewrite"
+	"github.com/madkins23/lsp-tester/tester/scenario"
 	"github.com/madkins23/lsp-tester/tester/web"
 )
 
 func main() {
 	var (
+		exitCode   int
 		err        error
 		flagSet    *flags.Set
 		logManager *logging.Manager
@@ -34,6 +48,13 @@ func main() {
 		waiter     sync.WaitGroup
 	)
 
+	// Registered first so that it is executed after all other deferred functions.
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	utilLog.Console()
 
 	flagSet = flags.NewSet()
@@ -68,6 +89,69 @@ func main() {
 	}
 
 	msgLogger = message.NewLogger(flagSet, logManager)
+	if flagSet.RecordPath() != "" {
+		if recorder, err := message.NewRecorder(flagSet.RecordPath()); err != nil {
+			log.Error().Err(err).Msg("Create message recorder")
+			return
+		} else {
+			defer recorder.Close()
+			msgLogger.AddObserver(recorder)
+		}
+	}
+	var history *message.History
+	if flagSet.WebPort() > 0 && flagSet.HistorySize() > 0 {
+		// Keep message history for the web server.
+		history = message.NewHistory(flagSet.HistorySize())
+		msgLogger.AddObserver(history)
+	}
+	if flagSet.RewritePath() != "" && flagSet.Mode() == flags.Nexus {
+		if rewriter, err := rewrite.LoadRules(flagSet.RewritePath()); err != nil {
+			log.Error().Err(err).Msg("Load rewrite rules")
+			return
+		} else {
+			lsp.SetRewriter(rewriter)
+		}
+	}
+	var injector *fault.Injector
+	if flagSet.Mode() == flags.Nexus && (flagSet.Faults() || flagSet.WebPort() > 0) {
+		// Faults may be turned on from the web server even if no flags are set.
+		if injector, err = fault.NewInjector(flagSet); err != nil {
+			log.Error().Err(err).Msg("Create fault injector")
+			return
+		}
+		lsp.SetFaulter(injector)
+	}
+	var stderr *sub.Stderr
+	if flagSet.Protocol() == flags.Sub || flagSet.Protocol() == flags.Reverse {
+		// Capture standard error from the LSP sub-process.
+		if stderr, err = sub.NewStderr(flagSet); err != nil {
+			log.Error().Err(err).Msg("Create stderr capture")
+			return
+		}
+		defer stderr.Close()
+		sub.SetStderr(stderr)
+	}
+	var checker *conform.Checker
+	if flagSet.MetaModelPath() != "" {
+		// Check messages against the LSP specification.
+		if checker, err = conform.NewChecker(flagSet); err != nil {
+			log.Error().Err(err).Msg("Create conformance checker")
+			return
+		}
+		msgLogger.AddObserver(checker)
+	}
+	// Check the LSP lifecycle of each connection.
+	tracker := lifecycle.NewTracker()
+	msgLogger.AddObserver(tracker)
+	// Report the capabilities negotiated on each connection.
+	reporter := capability.NewReporter()
+	msgLogger.AddObserver(reporter)
+	var interceptor *intercept.Interceptor
+	if flagSet.WebPort() > 0 && flagSet.Mode() == flags.Nexus {
+		// Hold messages at breakpoints set from the web server.
+		interceptor = intercept.NewInterceptor()
+		lsp.SetInterceptor(interceptor)
+	}
 	terminator = app.NewTerminator()
 	terminator.Add(lsp.NewTerminator())
 	app.HandleTerminalSignals(func(sig os.Signal) {
@@ -77,12 +161,62 @@ func main() {
 		}
 	})
 
-	var listener *tcp.Listener
+	var replayer *replay.Replayer
+	if flagSet.Mode() == flags.Replay {
+		if replayer, err = replay.NewReplayer(flagSet, msgLogger, terminator); err != nil {
+			log.Error().Err(err).Msg("Create replayer")
+			return
+		}
+		// Observe server messages before the server is started.
+		msgLogger.AddObserver(replayer)
+	}
+
+	var runner *scenario.Runner
+	if flagSet.ScenarioPath() != "" {
+		if runner, err = scenario.NewRunner(flagSet, msgLogger, terminator); err != nil {
+			log.Error().Err(err).Msg("Create scenario runner")
+			return
+		}
+		// Observe server messages before the server is started.
+		msgLogger.AddObserver(runner)
+		// Interrupt the scenario if the server exits.
+		terminator.Add(runner)
+	}
+
+	var rules *mock.Rules
+	if flagSet.MockPath() != "" {
+		if rules, err = mock.LoadRules(flagSet.MockPath()); err != nil {
+			log.Error().Err(err).Msg("Load mock rules")
+			return
+		}
+	}
+	var responder lsp.Responder
+	switch flagSet.Mode() {
+	case flags.Client:
+		// Answer requests from the server as there is no real client.
+		if rootURI, err := lsp.RootURI(flagSet); err != nil {
+			log.Error().Err(err).Msg("Get root URI")
+			return
+		} else if responder, err = mock.NewClient(rules, rootURI); err != nil {
+			log.Error().Err(err).Msg("Create mock client")
+			return
+		}
+	case flags.Server:
+		if rules != nil {
+			responder = rules
+		}
+	}
+
+	var listener web.Listener
 	switch flagSet.Protocol() {
 	case flags.Sub:
-		err = commandProtocol(flagSet, msgLogger, &waiter, terminator)
+		listener, err = commandProtocol(flagSet, responder, msgLogger, &waiter, terminator)
 	case flags.TCP:
-		listener, err = tcpProtocol(flagSet, msgLogger, &waiter, terminator)
+		listener, err = tcpProtocol(flagSet, responder, msgLogger, &waiter, terminator)
+	case flags.Pipe:
+		listener, err = pipeProtocol(flagSet, responder, msgLogger, &waiter, terminator)
+	case flags.Reverse:
+		listener, err = reverseProtocol(flagSet, responder, msgLogger, &waiter, terminator)
 	default:
 		log.Error().Str("protocol", flagSet.Protocol().String()).Msg("Unknown LSP communication protocol")
 		return
@@ -92,91 +226,235 @@ func main() {
 		return
 	}
 
-	webSrvr := web.NewWebServer(flagSet, listener, logManager, msgLogger, &waiter, terminator)
+	if replayer != nil {
+		go replayer.Run(lsp.GetReceiver("server"))
+	}
+	if runner != nil {
+		// The scenario result isn't known until the runner is done.
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			runner.Run(lsp.GetReceiver("server"))
+		}()
+	}
+
+	webSrvr := web.NewWebServer(flagSet, listener, logManager, msgLogger, &web.Options{
+		History:     history,
+		Interceptor: interceptor,
+		Injector:    injector,
+		Stderr:      stderr,
+		Checker:     checker,
+		Tracker:     tracker,
+		Reporter:    reporter,
+	}, &waiter, terminator)
 	if flagSet.WebPort() > 0 {
 		go webSrvr.Serve()
 	}
 
 	waiter.Wait()
+
+	msgLogger.Latency().LogSummary(&log.Logger)
+	if checker != nil {
+		checker.LogSummary(&log.Logger)
+	}
+	tracker.LogSummary(&log.Logger)
+	reporter.LogSummary(&log.Logger)
+
+	if runner != nil && runner.Failed() {
+		exitCode = 1
+	}
 }
 
-func commandProtocol(flagSet *flags.Set,
-	msgLogger *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) error {
+func commandProtocol(flagSet *flags.Set, responder lsp.Responder,
+	msgLogger *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) (web.Listener, error) {
 	//
 	var err error
 	var process lsp.Receiver
 	if flagSet.ModeConnectsToServer() {
 		process, err = sub.NewProcess("server", flagSet, msgLogger, waiter, terminator)
 		if err != nil {
-			return fmt.Errorf("create Process receiver: %w", err)
-		} else if err = process.Start(); err != nil {
-			return fmt.Errorf("start Process receiver: %w", err)
+			return nil, fmt.Errorf("create Process receiver: %w", err)
+		}
+		if flagSet.ModeConnectsToClient() && flagSet.WebSocketPort() > 0 {
+			// WebSocket clients are connected to the server via a Multiplexer.
+			mux, err := startServer(flagSet, process, responder, msgLogger)
+			if err != nil {
+				return nil, err
+			}
+			return wsClients(flagSet, mux, responder, msgLogger, waiter, terminator), nil
+		}
+		if !flagSet.ModeConnectsToClient() && responder != nil {
+			process.SetResponder(responder)
+		}
+		if err = process.Start(); err != nil {
+			return nil, fmt.Errorf("start Process receiver: %w", err)
 		} else {
+			handshake(flagSet, process)
 			sendRequest(flagSet, process, msgLogger)
 		}
 	}
 
 	if flagSet.ModeConnectsToClient() {
+		if flagSet.WebSocketPort() > 0 {
+			return wsClients(flagSet, nil, responder, msgLogger, waiter, terminator), nil
+		}
 		caller := sub.NewCaller("client", flagSet, msgLogger, waiter, terminator)
 		// Connect Receivers to each other before starting the Caller.
 		if process != nil {
 			caller.SetOther(process)
 			process.SetOther(caller)
+		} else if responder != nil {
+			caller.SetResponder(responder)
 		}
 		if err := caller.Start(); err != nil {
-			return fmt.Errorf("start Caller receiver: %w", err)
+			return nil, fmt.Errorf("start Caller receiver: %w", err)
 		}
 	}
 
-	return nil
+	return nil, nil
 }
 
-func tcpProtocol(flagSet *flags.Set,
-	msgLogger *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) (*tcp.Listener, error) {
+func tcpProtocol(flagSet *flags.Set, responder lsp.Responder,
+	msgLogger *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) (web.Listener, error) {
 	//
-	var client lsp.Receiver
+	var mux *lsp.Multiplexer
 	if flagSet.ModeConnectsToServer() {
 		connection, err := tcp.ConnectToLSP(flagSet)
 		if err != nil {
 			return nil, fmt.Errorf("connect to LSP %s:%d: %w", flagSet.HostAddress(), flagSet.ServerPort(), err)
 		}
 
-		client = tcp.NewReceiver("server", flagSet, connection, msgLogger, waiter, terminator)
-		if err = client.Start(); err != nil {
-			return nil, fmt.Errorf("create server Receiver: %w", err)
+		client := tcp.NewReceiver("server", flagSet, connection, msgLogger, waiter, terminator)
+		if mux, err = startServer(flagSet, client, responder, msgLogger); err != nil {
+			return nil, err
 		}
-
-		sendRequest(flagSet, client, msgLogger)
 	}
 
-	var err error
-	var listener *tcp.Listener
-	if flagSet.ModeConnectsToClient() {
-		if listener, err = tcp.NewListener(flagSet, waiter); err != nil {
-			log.Error().Err(err).Msgf("Make listener on %d", flagSet.ClientPort())
-		} else {
-			var server lsp.Receiver
-			ready := make(chan bool)
-			go listener.ListenForClient(ready, func(conn net.Conn) {
-				log.Info().Msg("Accepting client")
-				server = tcp.NewReceiver("client", flagSet, conn, msgLogger, waiter, terminator)
-				// Connect Receivers to each other before starting the client Receiver.
-				if client != nil {
-					client.SetOther(server)
-					server.SetOther(client)
-				}
-				if err = server.Start(); err != nil {
-					log.Error().Err(err).Msg("Unable to start ReceiverBase")
-					return
-				}
-			})
-			<-ready // Wait for listener to add to waiter.
+	return tcpClients(flagSet, mux, responder, msgLogger, waiter, terminator), nil
+}
+
+func pipeProtocol(flagSet *flags.Set, responder lsp.Responder,
+	msgLogger *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) (web.Listener, error) {
+	//
+	var mux *lsp.Multiplexer
+	if flagSet.ModeConnectsToServer() {
+		connection, err := pipe.ConnectToLSP(flagSet)
+		if err != nil {
+			return nil, fmt.Errorf("connect to LSP %s: %w", flagSet.ServerPipe(), err)
+		}
+
+		client := pipe.NewReceiver("server", flagSet, connection, msgLogger, waiter, terminator)
+		if mux, err = startServer(flagSet, client, responder, msgLogger); err != nil {
+			return nil, err
 		}
 	}
 
+	if !flagSet.ModeConnectsToClient() {
+		return nil, nil
+	} else if flagSet.WebSocketPort() > 0 {
+		return wsClients(flagSet, mux, responder, msgLogger, waiter, terminator), nil
+	}
+	listener, err := pipe.NewListener(flagSet, waiter)
+	if err != nil {
+		log.Error().Err(err).Msgf("Make listener on %s", flagSet.ClientPipe())
+		return nil, nil
+	}
+	ready := make(chan bool)
+	go listener.ListenForClient(ready, func(conn net.Conn) {
+		log.Info().Msg("Accepting client")
+		startClient(pipe.NewReceiver("client", flagSet, conn, msgLogger, waiter, terminator), mux, responder)
+	})
+	<-ready // Wait for listener to add to waiter.
 	return listener, nil
 }
 
+func reverseProtocol(flagSet *flags.Set, responder lsp.Responder,
+	msgLogger *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) (web.Listener, error) {
+	//
+	client, err := reverse.NewProcess("server", flagSet, msgLogger, waiter, terminator)
+	if err != nil {
+		return nil, fmt.Errorf("create reverse Process receiver: %w", err)
+	}
+	mux, err := startServer(flagSet, client, responder, msgLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	return tcpClients(flagSet, mux, responder, msgLogger, waiter, terminator), nil
+}
+
+// startServer starts the Receiver connected to the LSP server.
+// In Nexus mode the returned Multiplexer is used to connect clients to the server.
+func startServer(flagSet *flags.Set, client lsp.Receiver,
+	responder lsp.Responder, msgLogger *message.Logger) (*lsp.Multiplexer, error) {
+	//
+	var mux *lsp.Multiplexer
+	if flagSet.ModeConnectsToClient() {
+		// Multiple clients may connect to the server in Nexus mode.
+		mux = lsp.NewMultiplexer(flagSet, client, msgLogger)
+	} else if responder != nil {
+		client.SetResponder(responder)
+	}
+	if err := client.Start(); err != nil {
+		return nil, fmt.Errorf("create server Receiver: %w", err)
+	}
+
+	handshake(flagSet, client)
+	sendRequest(flagSet, client, msgLogger)
+	return mux, nil
+}
+
+// tcpClients listens for clients if the mode connects to clients.
+// Clients connect on the -wsPort if it is set, otherwise on the -clientPort.
+func tcpClients(flagSet *flags.Set, mux *lsp.Multiplexer, responder lsp.Responder,
+	msgLogger *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) web.Listener {
+	//
+	if !flagSet.ModeConnectsToClient() {
+		return nil
+	} else if flagSet.WebSocketPort() > 0 {
+		return wsClients(flagSet, mux, responder, msgLogger, waiter, terminator)
+	}
+	listener, err := tcp.NewListener(flagSet, waiter)
+	if err != nil {
+		log.Error().Err(err).Msgf("Make listener on %d", flagSet.ClientPort())
+		return nil
+	}
+	ready := make(chan bool)
+	go listener.ListenForClient(ready, func(conn net.Conn) {
+		log.Info().Msg("Accepting client")
+		startClient(tcp.NewReceiver("client", flagSet, conn, msgLogger, waiter, terminator), mux, responder)
+	})
+	<-ready // Wait for listener to add to waiter.
+	return listener
+}
+
+// wsClients listens on the -wsPort for browser-hosted clients.
+func wsClients(flagSet *flags.Set, mux *lsp.Multiplexer, responder lsp.Responder,
+	msgLogger *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) web.Listener {
+	//
+	listener := ws.NewListener(flagSet, waiter)
+	ready := make(chan bool)
+	go listener.ListenForClient(ready, func(conn *websocket.Conn) {
+		log.Info().Str("remote", conn.RemoteAddr().String()).Msg("Accepting WebSocket client")
+		startClient(ws.NewReceiver("client", flagSet, conn, msgLogger, waiter, terminator), mux, responder)
+	})
+	<-ready // Wait for listener to add to waiter.
+	return listener
+}
+
+// startClient starts the Receiver for a newly connected client.
+func startClient(server lsp.Receiver, mux *lsp.Multiplexer, responder lsp.Responder) {
+	// Connect client Receiver to server Receiver before starting it.
+	if mux != nil {
+		mux.AddClient(server)
+	} else if responder != nil {
+		server.SetResponder(responder)
+	}
+	if err := server.Start(); err != nil {
+		log.Error().Err(err).Msg("Unable to start ReceiverBase")
+	}
+}
+
 func logVersion() {
 	if info, ok := debug.ReadBuildInfo(); ok {
 		var target, arch string
@@ -210,6 +488,18 @@ func logVersion() {
 	}
 }
 
+// handshake initializes the server if requested by the -handshake flag.
+// The shutdown handshake is made by the lsp.Terminator.
+func handshake(flags *flags.Set, receiver lsp.Receiver) {
+	if flags.Handshake() {
+		if params, err := lsp.InitializeParams(flags); err != nil {
+			log.Error().Err(err).Msg("Build initialize parameters")
+		} else if _, err := receiver.Initialize(params); err != nil {
+			log.Error().Err(err).Msg("Initialize server")
+		}
+	}
+}
+
 func sendRequest(flags *flags.Set, receiver lsp.Receiver, msgLgr *message.Logger) {
 	if flags.RequestPath() != "" {
 		if rqst, err := message.LoadMessage(flags.RequestPath()); err != nil {
@@ -0,0 +1,272 @@
+package message
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Documents mirrors the text of the documents opened by the client.
+// The text is reconstructed from the didOpen, didChange, and didClose notifications.
+type Documents struct {
+	documents map[string]*Document
+	lock      sync.RWMutex
+}
+
+// Document is the current text of a single document.
+type Document struct {
+	URI        string    `json:"uri"`
+	LanguageID string    `json:"languageId"`
+	Version    int       `json:"version"`
+	Text       string    `json:"text"`
+	Changes    int       `json:"changes"`
+	Opened     time.Time `json:"opened"`
+	Updated    time.Time `json:"updated"`
+}
+
+// Position is a zero-based line and character offset in a document.
+// The character offset is in UTF-16 code units as specified by LSP.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span of text in a document.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Source is the text at a position in a document.
+type Source struct {
+	// Line is the source line without leading or trailing whitespace.
+	Line string
+	// Word is the identifier at the position or empty if there is none.
+	Word string
+}
+
+func NewDocuments() *Documents {
+	return &Documents{
+		documents: make(map[string]*Document),
+	}
+}
+
+// Track updates the documents from a didOpen, didChange, or didClose notification.
+// Other messages are ignored.
+func (d *Documents) Track(fields *Fields, content []byte) {
+	switch fields.Method {
+	case "textDocument/didOpen":
+		var notification struct {
+			Params struct {
+				TextDocument struct {
+					URI        string `json:"uri"`
+					LanguageID string `json:"languageId"`
+					Version    int    `json:"version"`
+					Text       string `json:"text"`
+				} `json:"textDocument"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(content, &notification); err != nil {
+			return
+		}
+		item := notification.Params.TextDocument
+		now := time.Now()
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.documents[item.URI] = &Document{
+			URI:        item.URI,
+			LanguageID: item.LanguageID,
+			Version:    item.Version,
+			Text:       item.Text,
+			Opened:     now,
+			Updated:    now,
+		}
+	case "textDocument/didChange":
+		var notification struct {
+			Params struct {
+				TextDocument struct {
+					URI     string `json:"uri"`
+					Version int    `json:"version"`
+				} `json:"textDocument"`
+				ContentChanges []struct {
+					// Range is nil if the text is the full content of the document.
+					Range *Range `json:"range"`
+					Text  string `json:"text"`
+				} `json:"contentChanges"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(content, &notification); err != nil {
+			return
+		}
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		doc, found := d.documents[notification.Params.TextDocument.URI]
+		if !found {
+			return
+		}
+		for _, change := range notification.Params.ContentChanges {
+			if change.Range == nil {
+				doc.Text = change.Text
+			} else {
+				start := offset(doc.Text, change.Range.Start)
+				end := offset(doc.Text, change.Range.End)
+				if end < start {
+					end = start
+				}
+				doc.Text = doc.Text[:start] + change.Text + doc.Text[end:]
+			}
+		}
+		doc.Version = notification.Params.TextDocument.Version
+		doc.Changes++
+		doc.Updated = time.Now()
+	case "textDocument/didClose":
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		delete(d.documents, DocumentURI(content))
+	}
+}
+
+// List returns copies of all documents sorted by URI.
+func (d *Documents) List() []*Document {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	list := make([]*Document, 0, len(d.documents))
+	for _, doc := range d.documents {
+		docCopy := *doc
+		list = append(list, &docCopy)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].URI < list[j].URI })
+	return list
+}
+
+// Get returns a copy of the document with the specified URI or nil if it is not open.
+func (d *Documents) Get(uri string) *Document {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if doc, found := d.documents[uri]; found {
+		docCopy := *doc
+		return &docCopy
+	}
+	return nil
+}
+
+// Source returns the source text at the position in the parameters of a message
+// or nil if the message has no position or the document is not open.
+func (d *Documents) Source(content []byte) *Source {
+	var msg struct {
+		Params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			Position *Position `json:"position"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(content, &msg); err != nil || msg.Params.Position == nil {
+		return nil
+	}
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	doc, found := d.documents[msg.Params.TextDocument.URI]
+	if !found {
+		return nil
+	}
+	start, end := lineBounds(doc.Text, msg.Params.Position.Line)
+	if start >= len(doc.Text) && msg.Params.Position.Line > 0 {
+		return nil
+	}
+	at := offset(doc.Text, *msg.Params.Position)
+	return &Source{
+		Line: strings.TrimSpace(doc.Text[start:end]),
+		Word: word(doc.Text[start:end], at-start),
+	}
+}
+
+// Lines returns the lines of the document text.
+func (doc *Document) Lines() []string {
+	return strings.Split(strings.ReplaceAll(doc.Text, "\r\n", "\n"), "\n")
+}
+
+//-----------------------------------------------------------------------------
+
+// lineBounds returns the byte offsets of the start and end of a line, excluding the line ending.
+// Both are the length of the text if there is no such line.
+func lineBounds(text string, line int) (int, int) {
+	start := 0
+	for ; line > 0; line-- {
+		next := strings.IndexByte(text[start:], '\n')
+		if next < 0 {
+			return len(text), len(text)
+		}
+		start += next + 1
+	}
+	end := len(text)
+	if next := strings.IndexByte(text[start:], '\n'); next >= 0 {
+		end = start + next
+	}
+	if end > start && text[end-1] == '\r' {
+		end--
+	}
+	return start, end
+}
+
+// offset converts a position to a byte offset in the text.
+// A character offset past the end of the line is the end of the line.
+func offset(text string, pos Position) int {
+	start, end := lineBounds(text, pos.Line)
+	units := 0
+	for i, r := range text[start:end] {
+		if units >= pos.Character {
+			return start + i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return end
+}
+
+// word returns the identifier containing or ending at the byte offset in the line.
+func word(line string, at int) string {
+	isWord := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	if at < 0 || at > len(line) {
+		return ""
+	}
+	start := at
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:start])
+		if !isWord(r) {
+			break
+		}
+		start -= size
+	}
+	end := at
+	for end < len(line) {
+		r, size := utf8.DecodeRuneInString(line[end:])
+		if !isWord(r) {
+			break
+		}
+		end += size
+	}
+	return line[start:end]
+}
+
+// DocumentURI returns the text document URI from the parameters of a message
+// or an empty string if there is none.
+func DocumentURI(content []byte) string {
+	var msg struct {
+		Params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(content, &msg); err != nil {
+		return ""
+	}
+	return msg.Params.TextDocument.URI
+}
@@ -0,0 +1,123 @@
+package message
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffset(t *testing.T) {
+	// "é" is two bytes and one UTF-16 unit, "😀" is four bytes and two UTF-16 units.
+	const text = "héllo\r\n😀 world\nlast"
+	for _, test := range []struct {
+		name     string
+		pos      Position
+		expected int
+	}{
+		{name: "start", pos: Position{0, 0}, expected: 0},
+		{name: "after two bytes", pos: Position{0, 2}, expected: 3},
+		{name: "end of line", pos: Position{0, 5}, expected: 6},
+		{name: "past end of CRLF line", pos: Position{0, 99}, expected: 6},
+		{name: "second line", pos: Position{1, 0}, expected: 8},
+		{name: "after surrogate pair", pos: Position{1, 2}, expected: 12},
+		{name: "after space", pos: Position{1, 3}, expected: 13},
+		{name: "last line", pos: Position{2, 4}, expected: len(text)},
+		{name: "missing line", pos: Position{5, 0}, expected: len(text)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, offset(text, test.pos))
+		})
+	}
+}
+
+func TestDocuments_Track(t *testing.T) {
+	const uri = "file:///a.txt"
+	docs := NewDocuments()
+	track := func(content string) {
+		docs.Track((&Entry{Content: []byte(content)}).Fields(), []byte(content))
+	}
+	change := func(version int, changes ...any) string {
+		content, err := json.Marshal(map[string]any{
+			"method": "textDocument/didChange",
+			"params": map[string]any{
+				"textDocument":   map[string]any{"uri": uri, "version": version},
+				"contentChanges": changes,
+			},
+		})
+		require.NoError(t, err)
+		return string(content)
+	}
+	edit := func(startLine, startChar, endLine, endChar int, text string) any {
+		return map[string]any{
+			"range": Range{Start: Position{startLine, startChar}, End: Position{endLine, endChar}},
+			"text":  text,
+		}
+	}
+
+	track(`{"method":"textDocument/didOpen","params":{"textDocument":{"uri":"` + uri +
+		`","languageId":"plaintext","version":1,"text":"héllo\n😀 world"}}}`)
+	for _, test := range []struct {
+		name     string
+		content  string
+		version  int
+		expected string
+	}{
+		{name: "insert", content: change(2, edit(0, 5, 0, 5, "!")), version: 2, expected: "héllo!\n😀 world"},
+		{name: "replace after surrogate pair", content: change(3, edit(1, 3, 1, 8, "there")), version: 3, expected: "héllo!\n😀 there"},
+		{name: "delete across lines", content: change(4, edit(0, 1, 1, 3, "")), version: 4, expected: "hthere"},
+		{
+			name:     "several changes in order",
+			content:  change(5, edit(0, 0, 0, 0, "1\n"), edit(1, 0, 1, 1, "T")),
+			version:  5,
+			expected: "1\nTthere",
+		},
+		{name: "backwards range", content: change(6, edit(1, 3, 1, 1, "+")), version: 6, expected: "1\nTth+ere"},
+		{name: "full text", content: change(7, map[string]any{"text": "new"}), version: 7, expected: "new"},
+		{name: "unknown document", content: `{"method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///b.txt","version":9}}}`, version: 7, expected: "new"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			track(test.content)
+			doc := docs.Get(uri)
+			require.NotNil(t, doc)
+			assert.Equal(t, test.version, doc.Version)
+			assert.Equal(t, test.expected, doc.Text)
+		})
+	}
+	assert.Equal(t, 6, docs.Get(uri).Changes)
+
+	track(`{"method":"textDocument/didClose","params":{"textDocument":{"uri":"` + uri + `"}}}`)
+	assert.Nil(t, docs.Get(uri))
+	assert.Empty(t, docs.List())
+}
+
+func TestDocuments_Source(t *testing.T) {
+	docs := NewDocuments()
+	open := `{"method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.go","text":"package a\r\n\n  x := résumé + 1\n"}}}`
+	docs.Track((&Entry{Content: []byte(open)}).Fields(), []byte(open))
+	hover := func(uri string, line, character int) []byte {
+		return []byte(`{"method":"textDocument/hover","params":{"textDocument":{"uri":"` + uri +
+			`"},"position":{"line":` + strconv.Itoa(line) + `,"character":` + strconv.Itoa(character) + `}}}`)
+	}
+	for _, test := range []struct {
+		name    string
+		content []byte
+		source  *Source
+	}{
+		{name: "first word", content: hover("file:///a.go", 0, 3), source: &Source{Line: "package a", Word: "package"}},
+		{name: "end of word", content: hover("file:///a.go", 0, 9), source: &Source{Line: "package a", Word: "a"}},
+		{name: "empty line", content: hover("file:///a.go", 1, 0), source: &Source{}},
+		{name: "not a word", content: hover("file:///a.go", 2, 5), source: &Source{Line: "x := résumé + 1"}},
+		{name: "multibyte word", content: hover("file:///a.go", 2, 10), source: &Source{Line: "x := résumé + 1", Word: "résumé"}},
+		{name: "after final newline", content: hover("file:///a.go", 3, 0)},
+		{name: "missing line", content: hover("file:///a.go", 9, 0)},
+		{name: "unknown document", content: hover("file:///b.go", 0, 0)},
+		{name: "no position", content: []byte(`{"method":"textDocument/didSave","params":{"textDocument":{"uri":"file:///a.go"}}}`)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.source, docs.Source(test.content))
+		})
+	}
+}
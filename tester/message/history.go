@@ -0,0 +1,256 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ Observer = (*History)(nil)
+
+// History keeps a bounded ring buffer of recent messages.
+// Messages are indexed by receiver, method, and ID.
+// Since messages are kept in time order they can be searched by time as well.
+type History struct {
+	items      []*HistoryItem
+	next       uint64
+	byReceiver map[string][]uint64
+	byMethod   map[string][]uint64
+	byID       map[string][]uint64
+	requests   map[string]uint64
+	lock       sync.RWMutex
+}
+
+// HistoryItem is a single message in the History.
+type HistoryItem struct {
+	*Entry
+	*Fields
+	// Seq is the sequence number of the message, starting with 1.
+	Seq uint64
+	// Pair is the sequence number of the matching request or response or zero.
+	Pair uint64
+}
+
+// HistoryFilter specifies criteria for searching the History.
+// Empty fields are not used.
+type HistoryFilter struct {
+	Receiver string
+	Method   string
+	ID       string
+	// Direction is ToServer, ToClient, or ToTester.
+	Direction string
+	// Text is searched for in the raw message content.
+	Text  string
+	Since time.Time
+	Until time.Time
+	// Limit the number of items returned, zero for no limit.
+	Limit int
+}
+
+func NewHistory(size int) *History {
+	return &History{
+		items:      make([]*HistoryItem, size),
+		byReceiver: make(map[string][]uint64),
+		byMethod:   make(map[string][]uint64),
+		byID:       make(map[string][]uint64),
+		requests:   make(map[string]uint64),
+	}
+}
+
+// Observe adds a message to the History, removing the oldest message if the History is full.
+func (h *History) Observe(entry *Entry) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.next++
+	item := &HistoryItem{
+		Entry:  entry,
+		Fields: entry.Fields(),
+		Seq:    h.next,
+	}
+	slot := int((item.Seq - 1) % uint64(len(h.items)))
+	if old := h.items[slot]; old != nil {
+		h.unindex(old)
+	}
+	h.items[slot] = item
+
+	for _, key := range item.receivers() {
+		h.byReceiver[key] = append(h.byReceiver[key], item.Seq)
+	}
+	if item.Method != "" {
+		h.byMethod[item.Method] = append(h.byMethod[item.Method], item.Seq)
+	}
+	if item.ID != nil {
+		key := idKey(item.ID)
+		h.byID[key] = append(h.byID[key], item.Seq)
+		switch item.Type {
+		case TypeRequest:
+			h.requests[pairKey(item.From, item.To, key)] = item.Seq
+		case TypeResponse:
+			// The response goes in the opposite direction from the request.
+			if seq, found := h.requests[pairKey(item.To, item.From, key)]; found {
+				if request := h.get(seq); request != nil {
+					item.Pair = seq
+					request.Pair = item.Seq
+				}
+			}
+		}
+	}
+}
+
+// Size returns the maximum number of messages kept in the History.
+func (h *History) Size() int {
+	return len(h.items)
+}
+
+// Get returns the item with the specified sequence number or nil if it is no longer available.
+func (h *History) Get(seq uint64) *HistoryItem {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.get(seq)
+}
+
+// Search returns the items matching the filter, most recent first.
+func (h *History) Search(filter *HistoryFilter) []*HistoryItem {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	var seqs []uint64
+	switch {
+	case filter.ID != "":
+		seqs = h.byID[filter.ID]
+	case filter.Method != "":
+		seqs = h.byMethod[filter.Method]
+	case filter.Receiver != "":
+		seqs = h.byReceiver[filter.Receiver]
+	default:
+		seqs = make([]uint64, 0, len(h.items))
+		for seq := h.oldest(); seq > 0 && seq <= h.next; seq++ {
+			seqs = append(seqs, seq)
+		}
+	}
+	if !filter.Since.IsZero() {
+		// Sequence numbers are in time order.
+		first := sort.Search(len(seqs), func(i int) bool {
+			item := h.get(seqs[i])
+			return item != nil && !item.Time.Before(filter.Since)
+		})
+		seqs = seqs[first:]
+	}
+
+	items := make([]*HistoryItem, 0)
+	for i := len(seqs) - 1; i >= 0; i-- {
+		if item := h.get(seqs[i]); item != nil && item.matches(filter) {
+			items = append(items, item)
+			if filter.Limit > 0 && len(items) >= filter.Limit {
+				break
+			}
+		}
+	}
+	return items
+}
+
+// HasReceiver returns true if the message was sent from or to the named receiver.
+func (hi *HistoryItem) HasReceiver(name string) bool {
+	return hi.From == name || hi.To == name
+}
+
+//-----------------------------------------------------------------------------
+
+func (h *History) get(seq uint64) *HistoryItem {
+	if seq == 0 || seq > h.next || seq < h.oldest() {
+		return nil
+	}
+	return h.items[int((seq-1)%uint64(len(h.items)))]
+}
+
+// oldest returns the sequence number of the oldest item or zero if there are none.
+func (h *History) oldest() uint64 {
+	if h.next <= uint64(len(h.items)) {
+		if h.next == 0 {
+			return 0
+		}
+		return 1
+	}
+	return h.next - uint64(len(h.items)) + 1
+}
+
+// unindex removes the item from all indexes.
+// The item is the oldest so it will be at the front of each index list.
+func (h *History) unindex(item *HistoryItem) {
+	for _, key := range item.receivers() {
+		removeFirst(h.byReceiver, key, item.Seq)
+	}
+	if item.Method != "" {
+		removeFirst(h.byMethod, item.Method, item.Seq)
+	}
+	if item.ID != nil {
+		key := idKey(item.ID)
+		removeFirst(h.byID, key, item.Seq)
+		if item.Type == TypeRequest {
+			if pk := pairKey(item.From, item.To, key); h.requests[pk] == item.Seq {
+				delete(h.requests, pk)
+			}
+		}
+	}
+}
+
+func (hi *HistoryItem) receivers() []string {
+	receivers := make([]string, 0, 2)
+	for _, name := range []string{hi.From, hi.To} {
+		if name != "tester" {
+			receivers = append(receivers, name)
+		}
+	}
+	return receivers
+}
+
+func (hi *HistoryItem) matches(filter *HistoryFilter) bool {
+	if filter.Receiver != "" && !hi.HasReceiver(filter.Receiver) {
+		return false
+	}
+	if filter.Method != "" && hi.Method != filter.Method {
+		return false
+	}
+	if filter.ID != "" && (hi.ID == nil || idKey(hi.ID) != filter.ID) {
+		return false
+	}
+	if filter.Direction != "" && hi.Direction() != filter.Direction {
+		return false
+	}
+	if filter.Text != "" && !bytes.Contains(hi.Content, []byte(filter.Text)) {
+		return false
+	}
+	if !filter.Since.IsZero() && hi.Time.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && hi.Time.After(filter.Until) {
+		return false
+	}
+	return true
+}
+
+func removeFirst(index map[string][]uint64, key string, seq uint64) {
+	if seqs := index[key]; len(seqs) > 0 && seqs[0] == seq {
+		if len(seqs) == 1 {
+			delete(index, key)
+		} else {
+			index[key] = seqs[1:]
+		}
+	}
+}
+
+// idKey returns the ID as a string so that 1 and "1" are the same key.
+func idKey(id json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(id, &str); err == nil {
+		return str
+	}
+	return string(id)
+}
+
+func pairKey(from, to, id string) string {
+	return from + ">" + to + "#" + id
+}
@@ -0,0 +1,112 @@
+package message
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEntries returns a hover request and response followed by didChange notifications.
+func testEntries(start time.Time, notifications int) []*Entry {
+	entries := []*Entry{
+		{Time: start, From: "client-1", To: "server", Content: []byte(`{"id":1,"method":"textDocument/hover"}`)},
+		{Time: start.Add(time.Second), From: "server", To: "client-1", Content: []byte(`{"id":1,"result":null}`)},
+	}
+	for i := 0; i < notifications; i++ {
+		entries = append(entries, &Entry{
+			Time:    start.Add(time.Duration(i+2) * time.Second),
+			From:    "client-1",
+			To:      "server",
+			Content: []byte(fmt.Sprintf(`{"method":"textDocument/didChange","params":{"version":%d}}`, i+1)),
+		})
+	}
+	return entries
+}
+
+func TestHistory_Ring(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		observed  int
+		available []uint64
+		gone      []uint64
+	}{
+		{name: "empty", observed: 0, gone: []uint64{0, 1}},
+		{name: "partial", observed: 2, available: []uint64{1, 2}, gone: []uint64{0, 3}},
+		{name: "full", observed: 4, available: []uint64{1, 2, 3, 4}, gone: []uint64{5}},
+		{name: "wrapped", observed: 6, available: []uint64{3, 4, 5, 6}, gone: []uint64{1, 2, 7}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			history := NewHistory(4)
+			for _, entry := range testEntries(time.Now(), 4)[:test.observed] {
+				history.Observe(entry)
+			}
+			for _, seq := range test.available {
+				item := history.Get(seq)
+				if assert.NotNil(t, item, "sequence %d", seq) {
+					assert.Equal(t, seq, item.Seq)
+				}
+			}
+			for _, seq := range test.gone {
+				assert.Nil(t, history.Get(seq), "sequence %d", seq)
+			}
+			all := history.Search(&HistoryFilter{})
+			require.Len(t, all, len(test.available))
+			for i, item := range all {
+				// Most recent first.
+				assert.Equal(t, test.available[len(test.available)-1-i], item.Seq)
+			}
+		})
+	}
+}
+
+func TestHistory_Pair(t *testing.T) {
+	history := NewHistory(4)
+	for _, entry := range testEntries(time.Now(), 1) {
+		history.Observe(entry)
+	}
+	assert.Equal(t, uint64(2), history.Get(1).Pair)
+	assert.Equal(t, uint64(1), history.Get(2).Pair)
+	assert.Zero(t, history.Get(3).Pair)
+}
+
+func TestHistory_Search(t *testing.T) {
+	start := time.Now()
+	history := NewHistory(5)
+	// The request and response are removed from the ring along with their index entries.
+	for _, entry := range testEntries(start, 6) {
+		history.Observe(entry)
+	}
+	assert.NotContains(t, history.byID, "1")
+	assert.NotContains(t, history.byMethod, "textDocument/hover")
+	for _, test := range []struct {
+		name   string
+		filter *HistoryFilter
+		seqs   []uint64
+	}{
+		{name: "all", filter: &HistoryFilter{}, seqs: []uint64{8, 7, 6, 5, 4}},
+		{name: "limit", filter: &HistoryFilter{Limit: 2}, seqs: []uint64{8, 7}},
+		{name: "method", filter: &HistoryFilter{Method: "textDocument/didChange", Limit: 3}, seqs: []uint64{8, 7, 6}},
+		{name: "removed method", filter: &HistoryFilter{Method: "textDocument/hover"}, seqs: []uint64{}},
+		{name: "removed ID", filter: &HistoryFilter{ID: "1"}, seqs: []uint64{}},
+		{name: "receiver", filter: &HistoryFilter{Receiver: "client-1", Limit: 1}, seqs: []uint64{8}},
+		{name: "other receiver", filter: &HistoryFilter{Receiver: "client-2"}, seqs: []uint64{}},
+		{name: "direction", filter: &HistoryFilter{Direction: ToClient}, seqs: []uint64{}},
+		{name: "text", filter: &HistoryFilter{Text: `"version":5`}, seqs: []uint64{7}},
+		{
+			name:   "time",
+			filter: &HistoryFilter{Since: start.Add(5 * time.Second), Until: start.Add(6 * time.Second)},
+			seqs:   []uint64{7, 6},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			seqs := make([]uint64, 0)
+			for _, item := range history.Search(test.filter) {
+				seqs = append(seqs, item.Seq)
+			}
+			assert.Equal(t, test.seqs, seqs)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package message
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Latency tracks the round-trip time of requests and keeps statistics per method.
+// A request is matched with the response going in the opposite direction with the same ID.
+type Latency struct {
+	pending map[string]*pendingRequest
+	methods map[string]*methodLatency
+	lock    sync.Mutex
+}
+
+// LatencySummary contains the statistics for a single method.
+// Durations are in nanoseconds in JSON.
+type LatencySummary struct {
+	Method string        `json:"method"`
+	Count  int           `json:"count"`
+	Errors int           `json:"errors"`
+	Min    time.Duration `json:"min"`
+	P50    time.Duration `json:"p50"`
+	P95    time.Duration `json:"p95"`
+	Max    time.Duration `json:"max"`
+}
+
+type pendingRequest struct {
+	method string
+	start  time.Time
+}
+
+type methodLatency struct {
+	count    int
+	errors   int
+	min, max time.Duration
+	// samples contains the most recent durations for calculating percentiles.
+	samples []time.Duration
+	next    int
+}
+
+const (
+	// latencySamples is the number of recent durations kept per method for percentiles.
+	latencySamples = 1000
+	// maxPending is the number of requests awaiting responses before old ones are removed.
+	maxPending = 1000
+	// pendingExpiration is the age after which requests awaiting responses may be removed.
+	pendingExpiration = time.Minute
+)
+
+func NewLatency() *Latency {
+	return &Latency{
+		pending: make(map[string]*pendingRequest),
+		methods: make(map[string]*methodLatency),
+	}
+}
+
+// Track records a request or matches a response to its request.
+// Returns the round-trip time and method for a response or zero if the message is not a matched response.
+func (l *Latency) Track(from, to string, fields *Fields) (time.Duration, string) {
+	if fields.ID == nil {
+		return 0, ""
+	}
+	now := time.Now()
+	id := idKey(fields.ID)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	switch fields.Type {
+	case TypeRequest:
+		if len(l.pending) >= maxPending {
+			l.expire(now)
+		}
+		l.pending[pairKey(from, to, id)] = &pendingRequest{method: fields.Method, start: now}
+	case TypeResponse:
+		// The response goes in the opposite direction from the request.
+		key := pairKey(to, from, id)
+		if request, found := l.pending[key]; found {
+			delete(l.pending, key)
+			elapsed := now.Sub(request.start)
+			l.record(request.method, elapsed, fields.Error)
+			return elapsed, request.method
+		}
+	}
+	return 0, ""
+}
+
+// Summary returns the statistics for all methods sorted by method name.
+func (l *Latency) Summary() []*LatencySummary {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	summary := make([]*LatencySummary, 0, len(l.methods))
+	for method, ml := range l.methods {
+		samples := append([]time.Duration{}, ml.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		summary = append(summary, &LatencySummary{
+			Method: method,
+			Count:  ml.count,
+			Errors: ml.errors,
+			Min:    ml.min,
+			P50:    percentile(samples, 50),
+			P95:    percentile(samples, 95),
+			Max:    ml.max,
+		})
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Method < summary[j].Method })
+	return summary
+}
+
+// LogSummary logs the statistics for each method.
+func (l *Latency) LogSummary(logger *zerolog.Logger) {
+	for _, ls := range l.Summary() {
+		logger.Info().Str("method", ls.Method).Int("count", ls.Count).Int("errors", ls.Errors).
+			Dur("min", ls.Min).Dur("p50", ls.P50).Dur("p95", ls.P95).Dur("max", ls.Max).
+			Msg("Latency")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// record adds a request duration to the statistics for the method.
+// Must be called with the lock held.
+func (l *Latency) record(method string, elapsed time.Duration, isError bool) {
+	ml, found := l.methods[method]
+	if !found {
+		ml = &methodLatency{min: elapsed, max: elapsed}
+		l.methods[method] = ml
+	}
+	ml.count++
+	if isError {
+		ml.errors++
+	}
+	if elapsed < ml.min {
+		ml.min = elapsed
+	}
+	if elapsed > ml.max {
+		ml.max = elapsed
+	}
+	if len(ml.samples) < latencySamples {
+		ml.samples = append(ml.samples, elapsed)
+	} else {
+		ml.samples[ml.next] = elapsed
+		ml.next = (ml.next + 1) % latencySamples
+	}
+}
+
+// expire removes old requests that have not received responses.
+// Must be called with the lock held.
+func (l *Latency) expire(now time.Time) {
+	for key, request := range l.pending {
+		if now.Sub(request.start) > pendingExpiration {
+			delete(l.pending, key)
+		}
+	}
+}
+
+// percentile returns the specified percentile of the sorted durations.
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	if len(sorted) < 1 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*pct/100]
+}
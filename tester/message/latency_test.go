@@ -0,0 +1,88 @@
+package message
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	durations := func(count int) []time.Duration {
+		sorted := make([]time.Duration, count)
+		for i := range sorted {
+			sorted[i] = time.Duration(i+1) * time.Millisecond
+		}
+		return sorted
+	}
+	for _, test := range []struct {
+		name     string
+		sorted   []time.Duration
+		pct      int
+		expected time.Duration
+	}{
+		{name: "empty", sorted: nil, pct: 50, expected: 0},
+		{name: "single", sorted: durations(1), pct: 95, expected: time.Millisecond},
+		{name: "median odd", sorted: durations(5), pct: 50, expected: 3 * time.Millisecond},
+		{name: "median even", sorted: durations(4), pct: 50, expected: 2 * time.Millisecond},
+		{name: "p95", sorted: durations(100), pct: 95, expected: 95 * time.Millisecond},
+		{name: "minimum", sorted: durations(100), pct: 0, expected: time.Millisecond},
+		{name: "maximum", sorted: durations(100), pct: 100, expected: 100 * time.Millisecond},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, percentile(test.sorted, test.pct))
+		})
+	}
+}
+
+func TestLatency_Summary(t *testing.T) {
+	latency := NewLatency()
+	// Record the durations out of order and with more than the number of samples kept.
+	for i := latencySamples + 10; i > 0; i-- {
+		latency.record("textDocument/hover", time.Duration(i)*time.Millisecond, i%100 == 0)
+	}
+	latency.record("initialize", time.Second, false)
+	summary := latency.Summary()
+	require.Len(t, summary, 2)
+	assert.Equal(t, &LatencySummary{
+		Method: "initialize", Count: 1, Min: time.Second, P50: time.Second, P95: time.Second, Max: time.Second,
+	}, summary[0])
+	hover := summary[1]
+	assert.Equal(t, latencySamples+10, hover.Count)
+	assert.Equal(t, 10, hover.Errors)
+	assert.Equal(t, time.Millisecond, hover.Min)
+	assert.Equal(t, time.Duration(latencySamples+10)*time.Millisecond, hover.Max)
+	// The oldest samples (the longest durations) have been replaced.
+	assert.Equal(t, time.Duration(latencySamples/2)*time.Millisecond, hover.P50)
+	assert.Equal(t, time.Duration(latencySamples*95/100)*time.Millisecond, hover.P95)
+}
+
+func TestLatency_Track(t *testing.T) {
+	fields := func(content string) *Fields {
+		return (&Entry{Content: json.RawMessage(content)}).Fields()
+	}
+	latency := NewLatency()
+	for _, test := range []struct {
+		name     string
+		from, to string
+		content  string
+		method   string
+	}{
+		{name: "request", from: "client-1", to: "server", content: `{"id":1,"method":"textDocument/hover"}`},
+		{name: "notification", from: "client-1", to: "server", content: `{"method":"textDocument/didOpen"}`},
+		{name: "same direction", from: "client-1", to: "server", content: `{"id":1,"result":null}`},
+		{name: "other client", from: "server", to: "client-2", content: `{"id":1,"result":null}`},
+		{name: "response", from: "server", to: "client-1", content: `{"id":1,"result":null}`, method: "textDocument/hover"},
+		{name: "repeated response", from: "server", to: "client-1", content: `{"id":1,"result":null}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, method := latency.Track(test.from, test.to, fields(test.content))
+			assert.Equal(t, test.method, method)
+		})
+	}
+	summary := latency.Summary()
+	require.Len(t, summary, 1)
+	assert.Equal(t, 1, summary[0].Count)
+}
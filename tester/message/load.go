@@ -2,8 +2,10 @@ package message
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/madkins23/lsp-tester/tester/data"
 	"github.com/madkins23/lsp-tester/tester/flags"
@@ -41,10 +43,30 @@ func (f *Files) LoadMessageFiles() error {
 	return nil
 }
 
+// List returns the names of the message files.
+// Returns nil if there is no message directory.
 func (f *Files) List() []string {
+	if f == nil {
+		return nil
+	}
 	return f.messages
 }
 
+// Path returns the path of the named message file in the message directory.
+// Only names returned by List are accepted so that the web server
+// can't be used to read files outside the message directory.
+func (f *Files) Path(name string) (string, error) {
+	if f == nil || f.flags.MessageDir() == "" {
+		return "", errors.New("no message directory (-messages)")
+	}
+	for _, msg := range f.messages {
+		if msg == name {
+			return filepath.Join(f.flags.MessageDir(), name), nil
+		}
+	}
+	return "", fmt.Errorf("no message file %s", name)
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 // LoadMessage loads the file at the specified path, unmarshals the JSON content,
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/madkins23/go-utils/log"
@@ -15,21 +16,81 @@ import (
 )
 
 type Logger struct {
-	flags  *flags.Set
-	logMgr *logging.Manager
+	flags     *flags.Set
+	logMgr    *logging.Manager
+	latency   *Latency
+	documents *Documents
+	observers []Observer
+	obsLock   sync.RWMutex
 }
 
 func NewLogger(flagSet *flags.Set, logMgr *logging.Manager) *Logger {
 	return &Logger{
-		flags:  flagSet,
-		logMgr: logMgr,
+		flags:     flagSet,
+		logMgr:    logMgr,
+		latency:   NewLatency(),
+		documents: NewDocuments(),
 	}
 }
 
+// Latency returns the request latency statistics for all messages.
+func (l *Logger) Latency() *Latency {
+	return l.latency
+}
+
+// Documents returns the mirror of the documents opened by the client.
+func (l *Logger) Documents() *Documents {
+	return l.documents
+}
+
+// AddObserver adds an Observer to be notified of each message.
+func (l *Logger) AddObserver(observer Observer) {
+	l.obsLock.Lock()
+	defer l.obsLock.Unlock()
+	l.observers = append(l.observers, observer)
+}
+
+// Message logs a message and notifies all observers.
+// If the -logMsgTwice flag is set a message passing through the tester
+// is logged as received by the tester and then sent by the tester.
+// The source text at any position in the message is logged if the document is open.
 func (l *Logger) Message(from, to, msg string, content []byte) {
-	l.messageTo(from, to, msg, content, l.logMgr.StdLogger(), l.logMgr.StdFormat())
+	fields := (&Entry{Content: content}).Fields()
+	elapsed, method := l.latency.Track(from, to, fields)
+	l.documents.Track(fields, content)
+	source := l.documents.Source(content)
+	if l.flags.LogMessageTwice() && from != "tester" && to != "tester" {
+		l.log(from, "tester", "Rcvd", content, 0, source)
+		l.log("tester", to, msg, content, elapsed, source)
+	} else {
+		l.log(from, to, msg, content, elapsed, source)
+	}
+
+	l.obsLock.RLock()
+	defer l.obsLock.RUnlock()
+	if len(l.observers) > 0 {
+		entry := &Entry{
+			Time: time.Now(),
+			From: from,
+			To:   to,
+			// Content buffer may be reused by caller.
+			Content:       append([]byte{}, content...),
+			Latency:       elapsed,
+			RequestMethod: method,
+		}
+		for _, observer := range l.observers {
+			observer.Observe(entry)
+		}
+	}
+}
+
+// log logs the message to the console and any log file.
+// The latency of a response to a request is logged if it is not zero.
+// The source line and word are logged if the source is not nil.
+func (l *Logger) log(from, to, msg string, content []byte, latency time.Duration, source *Source) {
+	l.messageTo(from, to, msg, content, latency, source, l.logMgr.StdLogger(), l.logMgr.StdFormat())
 	if l.logMgr.HasLogFile() {
-		l.messageTo(from, to, msg, content, l.logMgr.FileLogger(), l.logMgr.FileFormat())
+		l.messageTo(from, to, msg, content, latency, source, l.logMgr.FileLogger(), l.logMgr.FileFormat())
 	}
 }
 
@@ -41,28 +102,36 @@ const (
 	rightPrefix = ">"
 )
 
-func (l *Logger) messageTo(from, to, msg string, content []byte, logger *zerolog.Logger, format string) {
-	var direction string
-	var prefix = ""
+// arrow returns the direction of a message as a string with the server on the left
+// and clients on the right (e.g. "server<--client-1") along with the keyword prefix.
+// Returns empty strings if the direction can't be determined.
+func arrow(from, to string) (string, string) {
 	if strings.HasPrefix(from, "client") {
-		direction = to + leftArrow + from
-		prefix = leftPrefix
+		return to + leftArrow + from, leftPrefix
 	} else if from == "server" {
-		direction = from + rightArrow + to
-		prefix = rightPrefix
+		return from + rightArrow + to, rightPrefix
 	} else if strings.HasPrefix(to, "client") {
-		direction = from + rightArrow + to
-		prefix = rightPrefix
+		return from + rightArrow + to, rightPrefix
 	} else if to == "server" {
-		direction = to + leftArrow + from
-		prefix = leftPrefix
+		return to + leftArrow + from, leftPrefix
 	}
+	return "", ""
+}
+
+func (l *Logger) messageTo(from, to, msg string, content []byte, latency time.Duration, source *Source,
+	logger *zerolog.Logger, format string) {
+	//
+	direction, prefix := arrow(from, to)
 	if direction == "" {
 		log.Warn().Str("from", from).Str("to", to).Msg("Uncertain direction")
 		direction = from + rightArrow + to
 	}
 
 	event := logger.Info().Str("!", direction).Int("#size", len(content))
+	if latency > 0 {
+		event.Dur("#latency", latency)
+	}
+	addSourceToEvent(source, event)
 
 	if format == logging.FmtKeyword {
 		anyData := make(data.AnyMap)
@@ -71,6 +140,10 @@ func (l *Logger) messageTo(from, to, msg string, content []byte, logger *zerolog
 			// Fall through to end where raw JSON is added.
 		} else {
 			event = logger.Info().Str("!", direction).Int("#size", len(content))
+			if latency > 0 {
+				event.Dur("#latency", latency)
+			}
+			addSourceToEvent(source, event)
 			if err := l.keywordMessageFormat(anyData, event, prefix, msg); err != nil {
 				log.Warn().Err(err).Msg("keywordMessageFormat()")
 			}
@@ -81,6 +154,16 @@ func (l *Logger) messageTo(from, to, msg string, content []byte, logger *zerolog
 	event.RawJSON("msg", content).Msg(msg)
 }
 
+// addSourceToEvent adds the source line and the word at a position in the message, if any.
+func addSourceToEvent(source *Source, event *zerolog.Event) {
+	if source != nil {
+		event.Str("@line", source.Line)
+		if source.Word != "" {
+			event.Str("@word", source.Word)
+		}
+	}
+}
+
 // Keep ID maps below for this long before deleting them.
 const idExpiration = 5 * time.Second
 
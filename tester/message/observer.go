@@ -0,0 +1,122 @@
+package message
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Entry describes a single message passing through a Logger.
+type Entry struct {
+	Time    time.Time
+	From    string
+	To      string
+	Content []byte
+	// Latency is the round-trip time for a response to a request or zero.
+	Latency time.Duration
+	// RequestMethod is the method of the request for a response or empty.
+	RequestMethod string
+}
+
+// Direction returns the direction of the message (ToServer, ToClient, or ToTester).
+func (e *Entry) Direction() string {
+	return Direction(e.To)
+}
+
+// Connection returns the name of the connection between a client and the server for the message
+// and whether the message is going to the server.
+// The connection is named for the client (e.g. "client-1") or "tester" if the tester is the client.
+// The name is empty if the message is not between a client and the server.
+func (e *Entry) Connection() (string, bool) {
+	switch {
+	case strings.HasPrefix(e.From, "client"):
+		return e.From, true
+	case strings.HasPrefix(e.To, "client"):
+		return e.To, false
+	case e.To == "server":
+		return e.From, true
+	case e.From == "server":
+		return e.To, false
+	}
+	return "", false
+}
+
+// Arrow returns the direction of the message as shown in the log (e.g. "server<--client-1").
+func (e *Entry) Arrow() string {
+	if direction, _ := arrow(e.From, e.To); direction != "" {
+		return direction
+	}
+	return e.From + rightArrow + e.To
+}
+
+// Message types returned by Entry.Fields.
+const (
+	TypeRequest      = "request"
+	TypeResponse     = "response"
+	TypeNotification = "notification"
+	TypeUnknown      = "unknown"
+)
+
+// Fields contains the JSON RPC fields used to identify a message.
+type Fields struct {
+	Type   string
+	Method string
+	// ID is the raw JSON for the message ID or nil if there is none.
+	ID json.RawMessage
+	// Error is true for a response with an error.
+	Error bool
+}
+
+// Fields parses the message content for the fields used to identify the message.
+// Messages that can't be parsed are of TypeUnknown.
+func (e *Entry) Fields() *Fields {
+	var flds struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	fields := &Fields{Type: TypeUnknown}
+	if err := json.Unmarshal(e.Content, &flds); err != nil {
+		return fields
+	}
+	if string(flds.ID) != "null" {
+		fields.ID = flds.ID
+	}
+	fields.Method = flds.Method
+	if flds.Method != "" {
+		if fields.ID != nil {
+			fields.Type = TypeRequest
+		} else {
+			fields.Type = TypeNotification
+		}
+	} else if flds.Result != nil || flds.Error != nil {
+		fields.Type = TypeResponse
+		fields.Error = flds.Error != nil && string(flds.Error) != "null"
+	}
+	return fields
+}
+
+// Observer is notified of each message passing through a Logger.
+// Observers are called from multiple goroutines and must be thread-safe.
+// The Entry object must not be modified.
+type Observer interface {
+	Observe(entry *Entry)
+}
+
+const (
+	ToServer = "toServer"
+	ToClient = "toClient"
+	ToTester = "toTester"
+)
+
+// Direction returns the direction of a message based on its destination.
+func Direction(to string) string {
+	if to == "server" {
+		return ToServer
+	} else if strings.HasPrefix(to, "client") {
+		return ToClient
+	} else {
+		return ToTester
+	}
+}
@@ -0,0 +1,74 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var _ Observer = (*Recorder)(nil)
+
+// Recorder writes each message to a JSON Lines capture file.
+// The file can later be used to replay the session.
+type Recorder struct {
+	file    *os.File
+	encoder *json.Encoder
+	lock    sync.Mutex
+}
+
+// Record is a single line in a capture file.
+// The Msg field holds the message content if it is valid JSON,
+// otherwise the content is stored as a string in the Raw field.
+type Record struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"dir"`
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Size      int             `json:"size"`
+	Msg       json.RawMessage `json:"msg,omitempty"`
+	Raw       string          `json:"raw,omitempty"`
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	if file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666); err != nil {
+		return nil, fmt.Errorf("open record file %s: %w", path, err)
+	} else {
+		encoder := json.NewEncoder(file)
+		encoder.SetEscapeHTML(false)
+		return &Recorder{
+			file:    file,
+			encoder: encoder,
+		}, nil
+	}
+}
+
+func (r *Recorder) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_ = r.file.Close()
+}
+
+func (r *Recorder) Observe(entry *Entry) {
+	record := &Record{
+		Time:      entry.Time,
+		Direction: entry.Direction(),
+		From:      entry.From,
+		To:        entry.To,
+		Size:      len(entry.Content),
+	}
+	if json.Valid(entry.Content) {
+		record.Msg = entry.Content
+	} else {
+		record.Raw = string(entry.Content)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.encoder.Encode(record); err != nil {
+		log.Warn().Err(err).Msg("Write record")
+	}
+}
@@ -0,0 +1,85 @@
+package mock
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"text/template"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+)
+
+// Client provides responses to requests from an LSP server when there is no real client.
+// Requests are first checked against any mock Rules,
+// then answered with default results for requests known to block servers.
+// Any other request is answered with the unmatched error.
+type Client struct {
+	rules     *Rules
+	unmatched *template.Template
+	defaults  map[string]func(request data.AnyMap) any
+}
+
+// NewClient returns a Client responder using the specified rules, which may be nil.
+// The root URI is used to answer workspace/workspaceFolders requests.
+func NewClient(rules *Rules, rootURI string) (*Client, error) {
+	client := &Client{rules: rules}
+	if rules != nil {
+		client.unmatched = rules.unmatched
+	} else {
+		var err error
+		if client.unmatched, err = parseTemplate("unmatched", []byte(defaultUnmatched)); err != nil {
+			return nil, fmt.Errorf("parse unmatched error: %w", err)
+		}
+	}
+	rootName := rootURI
+	if parsed, err := url.Parse(rootURI); err == nil {
+		rootName = filepath.Base(parsed.Path)
+	}
+	client.defaults = map[string]func(request data.AnyMap) any{
+		"workspace/configuration":        configuration,
+		"window/workDoneProgress/create": nothing,
+		"window/showMessageRequest":      nothing,
+		"window/showDocument":            func(data.AnyMap) any { return data.AnyMap{"success": false} },
+		"client/registerCapability":      nothing,
+		"client/unregisterCapability":    nothing,
+		"workspace/applyEdit":            func(data.AnyMap) any { return data.AnyMap{"applied": false} },
+		"workspace/workspaceFolders": func(data.AnyMap) any {
+			return []data.AnyMap{{"uri": rootURI, "name": rootName}}
+		},
+		"workspace/codeLens/refresh":       nothing,
+		"workspace/diagnostic/refresh":     nothing,
+		"workspace/inlayHint/refresh":      nothing,
+		"workspace/inlineValue/refresh":    nothing,
+		"workspace/semanticTokens/refresh": nothing,
+	}
+	return client, nil
+}
+
+// Respond returns a response to the specified server request.
+func (c *Client) Respond(request data.AnyMap) (data.AnyMap, bool) {
+	if c.rules != nil {
+		if response, found := c.rules.Match(request); found {
+			return response, true
+		}
+	}
+	method, _ := request.GetStringField("method")
+	if result, found := c.defaults[method]; found {
+		return data.AnyMap{"result": result(request)}, true
+	}
+	return errorResponse(c.unmatched, request), true
+}
+
+// configuration returns a null setting for each requested configuration item.
+func configuration(request data.AnyMap) any {
+	var count int
+	if items, found := request.GetPath("params.items"); found {
+		if itemArray, ok := items.([]any); ok {
+			count = len(itemArray)
+		}
+	}
+	return make([]any, count)
+}
+
+func nothing(data.AnyMap) any {
+	return nil
+}
@@ -0,0 +1,269 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+)
+
+// JSON RPC error codes.
+const (
+	MethodNotFound = -32601
+	InternalError  = -32603
+)
+
+// Rules provides canned responses to requests based on the request method and parameters.
+// Rules are loaded from a JSON file of the form:
+//
+//	{
+//	  "rules": [
+//	    { "method": "initialize", "result": { "capabilities": { "hoverProvider": true } } },
+//	    { "method": "textDocument/hover", "params": { "position": { "line": 41 } },
+//	      "result": { "contents": "line {{.params.position.line}}", "uri": {{json .params.textDocument.uri}} } },
+//	    { "method": "textDocument/definition", "error": { "code": -32603, "message": "no definition" } }
+//	  ],
+//	  "unmatched": { "code": -32601, "message": "Method not found: {{.method}}" }
+//	}
+//
+// The first rule with a matching method and parameters is used.
+// Rule parameters match if every field in the rule is present with the same value in the request.
+// The result or error is a Go text/template executed with the request as data.
+// The json template function can be used to insert JSON for part of the request.
+// Template actions may appear outside JSON strings in results and errors
+// so the file is only valid JSON after the actions are replaced (see protectActions).
+type Rules struct {
+	rules     []*rule
+	unmatched *template.Template
+}
+
+type rule struct {
+	method string
+	params any
+	result *template.Template
+	error  *template.Template
+}
+
+type rulesFile struct {
+	Rules []struct {
+		Method string          `json:"method"`
+		Params any             `json:"params"`
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"rules"`
+	Unmatched json.RawMessage `json:"unmatched"`
+}
+
+const defaultUnmatched = `{"code": -32601, "message": "Method not found: {{.method}}"}`
+
+var templateFunctions = template.FuncMap{
+	"json": func(item any) (string, error) {
+		if jsonBytes, err := json.Marshal(item); err != nil {
+			return "", fmt.Errorf("marshal JSON: %w", err)
+		} else {
+			return string(jsonBytes), nil
+		}
+	},
+}
+
+// LoadRules loads the rules file at the specified path.
+func LoadRules(path string) (*Rules, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules file %s: %w", path, err)
+	}
+	rules, err := ParseRules(content)
+	if err != nil {
+		return nil, fmt.Errorf("rules file %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseRules parses the content of a rules file.
+func ParseRules(content []byte) (*Rules, error) {
+	var file rulesFile
+	protected, actions := protectActions(content)
+	if err := json.Unmarshal(protected, &file); err != nil {
+		return nil, fmt.Errorf("unmarshal rules: %w", err)
+	}
+
+	var err error
+	rules := &Rules{rules: make([]*rule, len(file.Rules))}
+	for i, item := range file.Rules {
+		if item.Method == "" {
+			return nil, fmt.Errorf("rule %d has no method", i)
+		}
+		rules.rules[i] = &rule{
+			method: item.Method,
+			params: item.Params,
+		}
+		if item.Error != nil {
+			if rules.rules[i].error, err = parseTemplate(item.Method, restoreActions(item.Error, actions)); err != nil {
+				return nil, fmt.Errorf("parse error for rule %d: %w", i, err)
+			}
+		} else {
+			if item.Result == nil {
+				item.Result = json.RawMessage("null")
+			}
+			if rules.rules[i].result, err = parseTemplate(item.Method, restoreActions(item.Result, actions)); err != nil {
+				return nil, fmt.Errorf("parse result for rule %d: %w", i, err)
+			}
+		}
+	}
+	if file.Unmatched == nil {
+		file.Unmatched = json.RawMessage(defaultUnmatched)
+	}
+	if rules.unmatched, err = parseTemplate("unmatched", restoreActions(file.Unmatched, actions)); err != nil {
+		return nil, fmt.Errorf("parse unmatched error: %w", err)
+	}
+	return rules, nil
+}
+
+// Respond returns a response to the specified request.
+// If no rule matches the request the response is the unmatched error.
+func (r *Rules) Respond(request data.AnyMap) (data.AnyMap, bool) {
+	if response, found := r.Match(request); found {
+		return response, true
+	}
+	return errorResponse(r.unmatched, request), true
+}
+
+// Match returns a response from the first rule that matches the specified request
+// or false if no rule matches.
+func (r *Rules) Match(request data.AnyMap) (data.AnyMap, bool) {
+	method, _ := request.GetStringField("method")
+	for _, rule := range r.rules {
+		if rule.method == method && Matches(rule.params, request["params"]) {
+			if rule.error != nil {
+				return errorResponse(rule.error, request), true
+			} else if result, err := execute(rule.result, request); err != nil {
+				log.Warn().Err(err).Str("method", method).Msg("Mock result")
+				return internalError(err), true
+			} else {
+				return data.AnyMap{"result": result}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Matches returns true if the value contains everything in the pattern.
+// Maps match if every field in the pattern matches the same field in the value.
+// Arrays match if they are the same length and every element matches.
+// A nil pattern matches anything.
+func Matches(pattern, value any) bool {
+	switch pat := pattern.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		if valMap, ok := value.(map[string]any); !ok {
+			return false
+		} else {
+			for key, item := range pat {
+				if field, found := valMap[key]; !found || !Matches(item, field) {
+					return false
+				}
+			}
+			return true
+		}
+	case []any:
+		if valArray, ok := value.([]any); !ok || len(pat) != len(valArray) {
+			return false
+		} else {
+			for i, item := range pat {
+				if !Matches(item, valArray[i]) {
+					return false
+				}
+			}
+			return true
+		}
+	default:
+		return reflect.DeepEqual(pattern, value)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// actionPlaceholder is the JSON string that replaces the numbered template action
+// outside of JSON strings so that the rules file can be unmarshaled.
+const actionPlaceholder = `"\u0000action %d"`
+
+// protectActions replaces template actions outside JSON strings with placeholder strings.
+// Returns the protected content and the replaced actions in order.
+func protectActions(content []byte) ([]byte, []string) {
+	var protected bytes.Buffer
+	var actions []string
+	inString, escaped := false, false
+	for i := 0; i < len(content); i++ {
+		char := content[i]
+		if inString {
+			if escaped {
+				escaped = false
+			} else if char == '\\' {
+				escaped = true
+			} else if char == '"' {
+				inString = false
+			}
+		} else if char == '"' {
+			inString = true
+		} else if bytes.HasPrefix(content[i:], []byte("{{")) {
+			if end := bytes.Index(content[i+2:], []byte("}}")); end >= 0 {
+				end += i + 4
+				protected.WriteString(fmt.Sprintf(actionPlaceholder, len(actions)))
+				actions = append(actions, string(content[i:end]))
+				i = end - 1
+				continue
+			}
+		}
+		protected.WriteByte(char)
+	}
+	return protected.Bytes(), actions
+}
+
+// restoreActions replaces the placeholder strings in raw JSON with the original template actions.
+func restoreActions(raw json.RawMessage, actions []string) json.RawMessage {
+	for i, action := range actions {
+		raw = bytes.ReplaceAll(raw, []byte(fmt.Sprintf(actionPlaceholder, i)), []byte(action))
+	}
+	return raw
+}
+
+func parseTemplate(name string, raw json.RawMessage) (*template.Template, error) {
+	return template.New(name).Funcs(templateFunctions).Parse(string(raw))
+}
+
+// execute a template with the request as data and unmarshal the resulting JSON.
+func execute(tmpl *template.Template, request data.AnyMap) (any, error) {
+	var buffer bytes.Buffer
+	var result any
+	if err := tmpl.Execute(&buffer, map[string]any(request)); err != nil {
+		return nil, fmt.Errorf("execute template: %w", err)
+	} else if err := json.Unmarshal(buffer.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("unmarshal template result: %w", err)
+	}
+	return result, nil
+}
+
+func errorResponse(tmpl *template.Template, request data.AnyMap) data.AnyMap {
+	if errData, err := execute(tmpl, request); err != nil {
+		log.Warn().Err(err).Msg("Mock error")
+		return internalError(err)
+	} else {
+		return data.AnyMap{"error": errData}
+	}
+}
+
+func internalError(err error) data.AnyMap {
+	return data.AnyMap{
+		"error": data.AnyMap{
+			"code":    InternalError,
+			"message": err.Error(),
+		},
+	}
+}
@@ -0,0 +1,153 @@
+package mock
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+)
+
+// readmeRules returns the example rules file from the README.
+func readmeRules(t *testing.T) []byte {
+	readme, err := os.ReadFile("../../README.md")
+	require.NoError(t, err)
+	_, example, found := strings.Cut(string(readme), "The rules file is a JSON object containing a list of rules:\n```\n")
+	require.True(t, found, "rules example in README")
+	example, _, found = strings.Cut(example, "```")
+	require.True(t, found, "end of rules example in README")
+	return []byte(example)
+}
+
+func TestParseRules_README(t *testing.T) {
+	rules, err := ParseRules(readmeRules(t))
+	require.NoError(t, err)
+	for _, test := range []struct {
+		name     string
+		request  data.AnyMap
+		response data.AnyMap
+	}{
+		{
+			name:    "initialize",
+			request: data.AnyMap{"method": "initialize", "params": map[string]any{}},
+			response: data.AnyMap{"result": map[string]any{
+				"capabilities": map[string]any{"hoverProvider": true},
+			}},
+		},
+		{
+			name: "hover template",
+			request: data.AnyMap{"method": "textDocument/hover", "params": map[string]any{
+				"textDocument": map[string]any{"uri": "file:///a.go"},
+				"position":     map[string]any{"line": float64(41), "character": float64(3)},
+			}},
+			response: data.AnyMap{"result": map[string]any{
+				"contents": "line 41",
+				"uri":      "file:///a.go",
+			}},
+		},
+		{
+			name: "hover fallback",
+			request: data.AnyMap{"method": "textDocument/hover", "params": map[string]any{
+				"position": map[string]any{"line": float64(7)},
+			}},
+			response: data.AnyMap{"result": nil},
+		},
+		{
+			name:    "error",
+			request: data.AnyMap{"method": "textDocument/definition"},
+			response: data.AnyMap{"error": map[string]any{
+				"code": float64(-32603), "message": "no definition",
+			}},
+		},
+		{
+			name:    "unmatched",
+			request: data.AnyMap{"method": "textDocument/rename"},
+			response: data.AnyMap{"error": map[string]any{
+				"code": float64(MethodNotFound), "message": "Method not found: textDocument/rename",
+			}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			response, ok := rules.Respond(test.request)
+			assert.True(t, ok)
+			assert.Equal(t, test.response, response)
+		})
+	}
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+	}{
+		{name: "not JSON", content: `{"rules": [`},
+		{name: "no method", content: `{"rules": [{"result": null}]}`},
+		{name: "bad template", content: `{"rules": [{"method": "x", "result": "{{.method"}]}`},
+		{name: "bad action", content: `{"rules": [{"method": "x", "result": {{if}} }]}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(test.content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestProtectActions(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		content   string
+		protected string
+		actions   []string
+	}{
+		{name: "none", content: `{"a": 1}`, protected: `{"a": 1}`},
+		{name: "in string", content: `{"a": "{{.b}}"}`, protected: `{"a": "{{.b}}"}`},
+		{name: "escaped quote", content: `{"a": "\"{{.b}}"}`, protected: `{"a": "\"{{.b}}"}`},
+		{
+			name:      "outside string",
+			content:   `{"a": {{json .b}}, "c": [{{.d}}]}`,
+			protected: `{"a": "\u0000action 0", "c": ["\u0000action 1"]}`,
+			actions:   []string{"{{json .b}}", "{{.d}}"},
+		},
+		{
+			name:      "end of object",
+			content:   `{"a": {{json .b}}}`,
+			protected: `{"a": "\u0000action 0"}`,
+			actions:   []string{"{{json .b}}"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			protected, actions := protectActions([]byte(test.content))
+			assert.Equal(t, test.protected, string(protected))
+			assert.Equal(t, test.actions, actions)
+			assert.Equal(t, test.content, string(restoreActions(protected, actions)))
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	value := map[string]any{
+		"position": map[string]any{"line": float64(41), "character": float64(3)},
+		"items":    []any{"a", "b"},
+	}
+	for _, test := range []struct {
+		name    string
+		pattern any
+		matches bool
+	}{
+		{name: "nil", pattern: nil, matches: true},
+		{name: "empty", pattern: map[string]any{}, matches: true},
+		{name: "nested field", pattern: map[string]any{"position": map[string]any{"line": float64(41)}}, matches: true},
+		{name: "wrong value", pattern: map[string]any{"position": map[string]any{"line": float64(40)}}, matches: false},
+		{name: "missing field", pattern: map[string]any{"uri": "file:///a.go"}, matches: false},
+		{name: "array", pattern: map[string]any{"items": []any{"a", "b"}}, matches: true},
+		{name: "array length", pattern: map[string]any{"items": []any{"a"}}, matches: false},
+		{name: "not a map", pattern: map[string]any{"items": map[string]any{}}, matches: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.matches, Matches(test.pattern, value))
+		})
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"path/filepath"
 	"regexp"
@@ -30,10 +29,17 @@ type ReceiverBase struct {
 	flags      *flags.Set
 	to         string
 	other      Receiver
+	mux        *Multiplexer
+	responder  Responder
 	logger     *zerolog.Logger
 	msgLogger  *message.Logger
 	terminator *app.Terminator
 	waiter     *sync.WaitGroup
+	awaiting   map[string]chan data.AnyMap
+	awaitLock  sync.Mutex
+	closed     atomic.Bool
+	// initialized is set after the initialize handshake is made by the tester.
+	initialized atomic.Bool
 }
 
 var sequence atomic.Uint32
@@ -53,6 +59,7 @@ func NewReceiver(to string, flags *flags.Set, handler Handler,
 		msgLogger:  msgLgr,
 		terminator: terminator,
 		waiter:     waiter,
+		awaiting:   make(map[string]chan data.AnyMap),
 	}
 }
 
@@ -79,12 +86,20 @@ func (lsp *ReceiverBase) SetOther(other Receiver) {
 	lsp.other = other
 }
 
+func (lsp *ReceiverBase) SetMultiplexer(mux *Multiplexer) {
+	lsp.mux = mux
+}
+
+func (lsp *ReceiverBase) SetResponder(responder Responder) {
+	lsp.responder = responder
+}
+
 func (lsp *ReceiverBase) Receive(ready *chan bool) {
 	lsp.logger.Info().Msg("Receiver starting")
 	defer lsp.logger.Info().Msg("Receiver finished")
 
-	receivers[lsp.to] = lsp
-	defer delete(receivers, lsp.to)
+	addReceiver(lsp.to, lsp)
+	defer removeReceiver(lsp.to)
 
 	lsp.waiter.Add(1)
 	defer lsp.waiter.Done()
@@ -101,6 +116,15 @@ func (lsp *ReceiverBase) Receive(ready *chan bool) {
 			continue
 		} else if contentLen < 0 {
 			lsp.logger.Error().Msg("End of file or broken connection")
+			if restarter, ok := lsp.Handler.(Restarter); ok && restarter.Restart() {
+				lsp.logger.Info().Msg("Connection restarted")
+				continue
+			}
+			lsp.closed.Store(true)
+			if lsp.mux != nil && lsp.to != "server" && lsp.mux.RemoveClient(lsp) > 0 {
+				// Other clients are still using the server.
+				return
+			}
 			if err := lsp.terminator.Shutdown(); err != nil {
 				lsp.logger.Error().Err(err).Msg("Terminating")
 			}
@@ -114,17 +138,22 @@ func (lsp *ReceiverBase) Receive(ready *chan bool) {
 		} else {
 			content = content[:contentLen]
 			lsp.logger.Debug().Any("other", lsp.other).Msg("Have content")
-			if lsp.other == nil {
+			if lsp.deliver(content) {
+				// Response to a request made by the tester is not forwarded.
 				lsp.msgLogger.Message(lsp.to, "tester", "Rcvd", content)
-			} else {
-				// TODO: What if there are multiple clients?
-				// How do we know which one server should send to?
-				from := lsp.to
-				if lsp.flags.LogMessageTwice() {
-					from = "tester"
-					lsp.msgLogger.Message(lsp.to, "tester", "Rcvd", content)
+			} else if lsp.mux == nil && lsp.other == nil {
+				lsp.msgLogger.Message(lsp.to, "tester", "Rcvd", content)
+				if lsp.responder != nil {
+					if err := lsp.respond(content); err != nil {
+						lsp.logger.Error().Err(err).Msg("Responding to request")
+					}
 				}
-				if err := lsp.other.SendContent(from, lsp.other.ConnectedTo(), content, lsp.msgLogger); err != nil {
+			} else if interceptor != nil && interceptor.Intercept(lsp.to, content, lsp.forward) {
+				lsp.logger.Debug().Msg("Message held")
+			} else if faulter != nil {
+				faulter.Fault(lsp.to, content, &link{from: lsp})
+			} else {
+				if err := lsp.forward(content); err != nil {
 					lsp.logger.Error().Err(err).Msg("Sending outgoing message")
 				}
 			}
@@ -132,18 +161,69 @@ func (lsp *ReceiverBase) Receive(ready *chan bool) {
 	}
 }
 
-const (
-	idRandomRange  = 1000
-	jsonRpcVersion = "2.0"
-)
+// forward sends content to the other Receiver or via the Multiplexer.
+func (lsp *ReceiverBase) forward(content []byte) error {
+	if lsp.mux == nil {
+		to := lsp.other.ConnectedTo()
+		if rewritten, keep := rewrite(lsp.to, to, content, lsp.msgLogger); keep {
+			return lsp.other.SendContent(lsp.to, to, rewritten, lsp.msgLogger)
+		}
+		return nil
+	} else if lsp.to == "server" {
+		return lsp.mux.FromServer(content)
+	} else {
+		return lsp.mux.FromClient(lsp, content)
+	}
+}
+
+// rewrite applies the Rewriter (if any) to content forwarded between the named Receivers.
+// Returns false if the message is dropped, in which case it is logged as received by the tester.
+func rewrite(from, to string, content []byte, msgLgr *message.Logger) ([]byte, bool) {
+	if rewriter == nil {
+		return content, true
+	}
+	rewritten, keep := rewriter.Rewrite(from, to, content)
+	if !keep {
+		msgLgr.Message(from, "tester", "Rcvd", content)
+	}
+	return rewritten, keep
+}
+
+// respond sends a response generated by the Responder if the content is a request.
+func (lsp *ReceiverBase) respond(content []byte) error {
+	request := make(data.AnyMap)
+	if err := json.Unmarshal(content, &request); err != nil {
+		return fmt.Errorf("unmarshal request: %w", err)
+	}
+	if !request.HasField("method") || !request.HasField("id") {
+		// Notifications and responses don't get responses.
+		return nil
+	}
+	if response, ok := lsp.responder.Respond(request); ok {
+		response["jsonrpc"] = jsonRpcVersion
+		response["id"] = request["id"]
+		if content, err := json.Marshal(response); err != nil {
+			return fmt.Errorf("marshal response: %w", err)
+		} else if err := lsp.SendContent("tester", lsp.to, content, lsp.msgLogger); err != nil {
+			return fmt.Errorf("send response: %w", err)
+		}
+	}
+	return nil
+}
+
+const jsonRpcVersion = "2.0"
 
 // SendMessage marshals a data.AnyMap object and sends it to the specified connection.
 // The data object is edited to contain a JSON RPC version, a request ID,
 // and contained relative path fields are replaced with absolute paths.
 func (lsp *ReceiverBase) SendMessage(to string, message data.AnyMap, msgLgr *message.Logger) error {
+	message["id"] = newID()
+	return lsp.SendMessageWithID(to, message, msgLgr)
+}
+
+// SendMessageWithID works like SendMessage but keeps any request ID in the data object.
+func (lsp *ReceiverBase) SendMessageWithID(to string, message data.AnyMap, msgLgr *message.Logger) error {
 	message["jsonrpc"] = jsonRpcVersion
-	message["id"] = strconv.Itoa(idRandomRange + rand.Intn(idRandomRange))
-	//message["id"] = idRandomRange + rand.Intn(idRandomRange)
 
 	if params, ok := message["params"].(data.AnyMap); ok {
 		if path, found := params["path"]; found {
@@ -165,9 +245,14 @@ func (lsp *ReceiverBase) SendMessage(to string, message data.AnyMap, msgLgr *mes
 
 const msgHeaderFormat = "Content-Length: %d\r\n\r\n%s"
 
-// SendContent sends byte array content via the specified lsp.Handler.
+// SendContent logs byte array content and sends it via the specified lsp.Handler.
 func (lsp *ReceiverBase) SendContent(from, to string, content []byte, msgLgr *message.Logger) error {
 	msgLgr.Message(from, to, "Send", content)
+	return lsp.WriteContent(content)
+}
+
+// WriteContent sends byte array content via the specified lsp.Handler without logging it.
+func (lsp *ReceiverBase) WriteContent(content []byte) error {
 	msg := fmt.Sprintf(msgHeaderFormat, len(content), string(content))
 	if _, err := lsp.Writer().Write([]byte(msg)); err != nil {
 		return fmt.Errorf("write content: %w", err)
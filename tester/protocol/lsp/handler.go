@@ -10,3 +10,11 @@ type Handler interface {
 	Writer() io.Writer
 	Kill() error
 }
+
+// Restarter may be implemented by a Handler that can replace its connection
+// when the connection ends (e.g. by restarting a crashed LSP sub-process).
+type Restarter interface {
+	// Restart replaces the connection, returning false if the Receiver should finish instead.
+	// The Reader and Writer of the Handler must use the new connection after Restart returns true.
+	Restart() bool
+}
@@ -0,0 +1,186 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+const (
+	initializeTimeout = 30 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// RootURI returns the -rootUri flag value or, if not set, the file URI of the current directory.
+func RootURI(flags *flags.Set) (string, error) {
+	if rootURI := flags.RootURI(); rootURI != "" {
+		return rootURI, nil
+	} else if dir, err := os.Getwd(); err != nil {
+		return "", fmt.Errorf("get working directory: %w", err)
+	} else {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String(), nil
+	}
+}
+
+// InitializeParams builds the parameters for an initialize request from flag settings.
+func InitializeParams(flags *flags.Set) (data.AnyMap, error) {
+	rootURI, err := RootURI(flags)
+	if err != nil {
+		return nil, fmt.Errorf("root URI: %w", err)
+	}
+	capabilities := make(data.AnyMap)
+	if capPath := flags.CapabilitiesPath(); capPath != "" {
+		if capabilities, err = message.LoadMessage(capPath); err != nil {
+			return nil, fmt.Errorf("load capabilities: %w", err)
+		}
+	}
+	clientInfo := data.AnyMap{"name": flags.ClientName()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		clientInfo["version"] = info.Main.Version
+	}
+	rootName := rootURI
+	if parsed, err := url.Parse(rootURI); err == nil {
+		rootName = filepath.Base(parsed.Path)
+	}
+	return data.AnyMap{
+		"processId":    os.Getpid(),
+		"clientInfo":   clientInfo,
+		"rootUri":      rootURI,
+		"capabilities": capabilities,
+		"workspaceFolders": []data.AnyMap{
+			{"uri": rootURI, "name": rootName},
+		},
+	}, nil
+}
+
+// Initialize performs the initialize request and initialized notification handshake.
+// Returns the result of the initialize request.
+func (lsp *ReceiverBase) Initialize(params data.AnyMap) (data.AnyMap, error) {
+	response, err := lsp.Request("initialize", params, initializeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("initialize request: %w", err)
+	}
+	if err = lsp.Notify("initialized", data.AnyMap{}); err != nil {
+		return nil, fmt.Errorf("initialized notification: %w", err)
+	}
+	lsp.initialized.Store(true)
+	result, _ := response["result"].(map[string]any)
+	return result, nil
+}
+
+// Exit performs the shutdown request and exit notification handshake
+// if the Receiver was initialized via the Initialize method and is still connected.
+func (lsp *ReceiverBase) Exit() error {
+	if lsp.closed.Load() || !lsp.initialized.CompareAndSwap(true, false) {
+		return nil
+	}
+	if _, err := lsp.Request("shutdown", nil, shutdownTimeout); err != nil {
+		return fmt.Errorf("shutdown request: %w", err)
+	}
+	if err := lsp.Notify("exit", nil); err != nil {
+		return fmt.Errorf("exit notification: %w", err)
+	}
+	return nil
+}
+
+// Request sends a request from the tester and waits for the response.
+// The response is logged but not forwarded to any other Receiver.
+// An error is returned if the response contains an error or does not arrive before the timeout.
+func (lsp *ReceiverBase) Request(method string, params any, timeout time.Duration) (data.AnyMap, error) {
+	id := newID()
+	request := data.AnyMap{
+		"jsonrpc": jsonRpcVersion,
+		"id":      id,
+		"method":  method,
+	}
+	if params != nil {
+		request["params"] = params
+	}
+	content, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	responseChan := make(chan data.AnyMap, 1)
+	lsp.awaitLock.Lock()
+	lsp.awaiting[id] = responseChan
+	lsp.awaitLock.Unlock()
+	defer func() {
+		lsp.awaitLock.Lock()
+		delete(lsp.awaiting, id)
+		lsp.awaitLock.Unlock()
+	}()
+
+	if err := lsp.SendContent("tester", lsp.to, content, lsp.msgLogger); err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	select {
+	case response := <-responseChan:
+		if errData, found := response.GetField("error"); found {
+			if jsonBytes, err := json.Marshal(errData); err == nil {
+				return response, fmt.Errorf("error response: %s", string(jsonBytes))
+			}
+			return response, errors.New("error response")
+		}
+		return response, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no response to %s after %s", method, timeout)
+	}
+}
+
+// Notify sends a notification from the tester.
+func (lsp *ReceiverBase) Notify(method string, params any) error {
+	notification := data.AnyMap{
+		"jsonrpc": jsonRpcVersion,
+		"method":  method,
+	}
+	if params != nil {
+		notification["params"] = params
+	}
+	if content, err := json.Marshal(notification); err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	} else if err := lsp.SendContent("tester", lsp.to, content, lsp.msgLogger); err != nil {
+		return fmt.Errorf("send notification: %w", err)
+	}
+	return nil
+}
+
+// deliver checks whether the content is a response to a request made via the Request method.
+// If so the response is delivered to the waiting request and true is returned.
+func (lsp *ReceiverBase) deliver(content []byte) bool {
+	lsp.awaitLock.Lock()
+	defer lsp.awaitLock.Unlock()
+	if len(lsp.awaiting) < 1 {
+		return false
+	}
+	response := make(data.AnyMap)
+	if err := json.Unmarshal(content, &response); err != nil || response.HasField("method") {
+		return false
+	}
+	if id, found := response.GetStringField("id"); !found {
+		return false
+	} else if responseChan, found := lsp.awaiting[id]; !found {
+		return false
+	} else {
+		delete(lsp.awaiting, id)
+		responseChan <- response
+		return true
+	}
+}
+
+// newID returns a random four digit request ID.
+func newID() string {
+	const idRange = 1000
+	return strconv.Itoa(idRange + rand.Intn(idRange))
+}
@@ -0,0 +1,48 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+)
+
+var _ Link = (*link)(nil)
+
+// link sends content from a Receiver toward its destination for a Faulter.
+type link struct {
+	from *ReceiverBase
+}
+
+func (l *link) Forward(content []byte) error {
+	return l.from.forward(content)
+}
+
+func (l *link) WriteFrame(frame []byte) error {
+	if dest, err := l.destination(); err != nil {
+		return err
+	} else if _, err := dest.Writer().Write(frame); err != nil {
+		return fmt.Errorf("write frame to %s: %w", dest.ConnectedTo(), err)
+	}
+	return nil
+}
+
+func (l *link) Close() error {
+	if dest, err := l.destination(); err != nil {
+		return err
+	} else if err := dest.Kill(); err != nil {
+		return fmt.Errorf("close %s: %w", dest.ConnectedTo(), err)
+	}
+	return nil
+}
+
+func (l *link) destination() (Receiver, error) {
+	var dest Receiver
+	if l.from.mux != nil {
+		dest = l.from.mux.Destination(l.from)
+	} else {
+		dest = l.from.other
+	}
+	if dest == nil {
+		return nil, errors.New("no destination")
+	}
+	return dest, nil
+}
@@ -0,0 +1,277 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+// Multiplexer routes messages between a single server Receiver and
+// any number of client Receivers connected at the same time.
+//
+// Request IDs from clients are rewritten while more than one client is connected
+// so that each response from the server can be returned to the client that made the request.
+// Server notifications and requests are sent to one or more clients
+// according to the flags.NotifyPolicy.
+type Multiplexer struct {
+	flags   *flags.Set
+	logger  *zerolog.Logger
+	msgLgr  *message.Logger
+	server  Receiver
+	clients []Receiver
+	recent  Receiver
+	pending map[string]*pendingRequest
+	lock    sync.Mutex
+}
+
+// pendingRequest records the client that sent a request and the request's original ID.
+type pendingRequest struct {
+	client Receiver
+	id     json.RawMessage
+}
+
+func NewMultiplexer(flags *flags.Set, server Receiver, msgLgr *message.Logger) *Multiplexer {
+	logger := log.With().Str("svc", "mux").Logger()
+	mux := &Multiplexer{
+		flags:   flags,
+		logger:  &logger,
+		msgLgr:  msgLgr,
+		server:  server,
+		clients: make([]Receiver, 0, 2),
+		pending: make(map[string]*pendingRequest),
+	}
+	server.SetMultiplexer(mux)
+	return mux
+}
+
+// AddClient adds a newly connected client Receiver.
+// This should be done before the client Receiver is started.
+func (m *Multiplexer) AddClient(client Receiver) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.clients = append(m.clients, client)
+	client.SetMultiplexer(m)
+	m.logger.Debug().Str("client", client.ConnectedTo()).Int("clients", len(m.clients)).Msg("Add client")
+}
+
+// RemoveClient removes a disconnected client Receiver.
+// Returns the number of clients still connected.
+func (m *Multiplexer) RemoveClient(client Receiver) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for i, rcvr := range m.clients {
+		if rcvr == client {
+			m.clients = append(m.clients[:i], m.clients[i+1:]...)
+			break
+		}
+	}
+	for id, pending := range m.pending {
+		if pending.client == client {
+			delete(m.pending, id)
+		}
+	}
+	if m.recent == client {
+		m.recent = nil
+	}
+	m.logger.Debug().Str("client", client.ConnectedTo()).Int("clients", len(m.clients)).Msg("Remove client")
+	return len(m.clients)
+}
+
+// FromClient sends content received from a client Receiver to the server.
+// The content is logged as sent by the client but written to the server
+// with any request ID rewritten to be unique across all clients.
+func (m *Multiplexer) FromClient(client Receiver, content []byte) error {
+	content, keep := rewrite(client.ConnectedTo(), m.server.ConnectedTo(), content, m.msgLgr)
+	if !keep {
+		return nil
+	}
+	wire := m.rewriteClientContent(client, content)
+	m.msgLgr.Message(client.ConnectedTo(), m.server.ConnectedTo(), "Send", content)
+	if err := m.server.WriteContent(wire); err != nil {
+		return fmt.Errorf("write to server: %w", err)
+	}
+	return nil
+}
+
+// FromServer sends content received from the server to the appropriate client(s).
+// Responses are returned to the client that sent the request with the original request ID.
+// Notifications and server requests are sent according to the flags.NotifyPolicy.
+// A failure to send to one client does not keep the content from the other clients.
+func (m *Multiplexer) FromServer(content []byte) error {
+	targets, content := m.routeServerContent(content)
+	if len(targets) < 1 {
+		m.msgLgr.Message(m.server.ConnectedTo(), "tester", "Rcvd", content)
+		return nil
+	}
+	var errs []error
+	for _, target := range targets {
+		// Rules may differ by client so each copy is rewritten separately.
+		rewritten, keep := rewrite(m.server.ConnectedTo(), target.ConnectedTo(), content, m.msgLgr)
+		if !keep {
+			continue
+		}
+		if err := target.SendContent(m.server.ConnectedTo(), target.ConnectedTo(), rewritten, m.msgLgr); err != nil {
+			errs = append(errs, fmt.Errorf("send to %s: %w", target.ConnectedTo(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Destination returns the Receiver to which content from the specified Receiver would be sent.
+// Server content may go to more than one client, in which case only one is returned.
+func (m *Multiplexer) Destination(from Receiver) Receiver {
+	if from.ConnectedTo() != m.server.ConnectedTo() {
+		return m.server
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if targets := m.targets(false); len(targets) > 0 {
+		return targets[0]
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+const cancelRequest = "$/cancelRequest"
+
+func (m *Multiplexer) rewriteClientContent(client Receiver, content []byte) []byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.recent = client
+	msg := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(content, &msg); err != nil {
+		m.logger.Warn().Err(err).Msg("Unmarshal client content")
+		return content
+	}
+
+	id, hasID := msg["id"]
+	_, hasMethod := msg["method"]
+	if hasID && hasMethod {
+		// Request from the client.
+		serverID := id
+		if len(m.clients) > 1 {
+			serverID = m.serverID(client, id)
+			msg["id"] = serverID
+		}
+		m.pending[string(serverID)] = &pendingRequest{client: client, id: id}
+	} else if method := rawString(msg["method"]); method == cancelRequest {
+		// Cancellation must refer to the ID the server knows.
+		params := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(msg["params"], &params); err != nil {
+			m.logger.Warn().Err(err).Msg("Unmarshal cancel parameters")
+			return content
+		}
+		serverID := m.serverID(client, params["id"])
+		if _, found := m.pending[string(serverID)]; !found {
+			return content
+		}
+		params["id"] = serverID
+		var err error
+		if msg["params"], err = json.Marshal(params); err != nil {
+			m.logger.Warn().Err(err).Msg("Marshal cancel parameters")
+			return content
+		}
+	} else {
+		return content
+	}
+
+	if wire, err := json.Marshal(msg); err != nil {
+		m.logger.Warn().Err(err).Msg("Marshal client content")
+		return content
+	} else {
+		m.logger.Debug().RawJSON("id", id).Str("client", client.ConnectedTo()).Msg("Rewrite")
+		return wire
+	}
+}
+
+func (m *Multiplexer) routeServerContent(content []byte) ([]Receiver, []byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	msg := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(content, &msg); err != nil {
+		m.logger.Warn().Err(err).Msg("Unmarshal server content")
+		return m.targets(false), content
+	}
+
+	id, hasID := msg["id"]
+	if _, hasMethod := msg["method"]; hasMethod {
+		// Only notifications are broadcast, a request must go to a single client.
+		return m.targets(!hasID), content
+	} else if !hasID {
+		return m.targets(false), content
+	}
+
+	pending, found := m.pending[string(id)]
+	if !found {
+		m.logger.Debug().RawJSON("id", id).Msg("Response to unknown request")
+		return m.targets(false), content
+	}
+	delete(m.pending, string(id))
+	if string(pending.id) != string(id) {
+		msg["id"] = pending.id
+		if restored, err := json.Marshal(msg); err != nil {
+			m.logger.Warn().Err(err).Msg("Marshal server content")
+		} else {
+			content = restored
+		}
+	}
+	return []Receiver{pending.client}, content
+}
+
+// serverID returns a request ID unique to the specified client.
+func (m *Multiplexer) serverID(client Receiver, id json.RawMessage) json.RawMessage {
+	idStr := rawString(id)
+	if idStr == "" {
+		idStr = string(id)
+	}
+	if serverID, err := json.Marshal(client.ConnectedTo() + "/" + idStr); err != nil {
+		m.logger.Warn().Err(err).Msg("Marshal server ID")
+		return id
+	} else {
+		return serverID
+	}
+}
+
+// targets returns the client(s) for a server message based on the flags.NotifyPolicy.
+// Must be called with the lock held.
+func (m *Multiplexer) targets(broadcast bool) []Receiver {
+	if len(m.clients) < 1 {
+		return nil
+	}
+	switch m.flags.NotifyPolicy() {
+	case flags.NotifyBroadcast:
+		if broadcast {
+			return append([]Receiver{}, m.clients...)
+		}
+	case flags.NotifyFirst:
+		return []Receiver{m.clients[0]}
+	case flags.NotifyLast:
+		return []Receiver{m.clients[len(m.clients)-1]}
+	}
+	if m.recent != nil {
+		return []Receiver{m.recent}
+	}
+	return []Receiver{m.clients[len(m.clients)-1]}
+}
+
+// rawString returns the string value of a raw JSON string or the empty string.
+func rawString(raw json.RawMessage) string {
+	var str string
+	if strings.HasPrefix(string(raw), `"`) {
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return ""
+		}
+	}
+	return str
+}
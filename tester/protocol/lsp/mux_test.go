@@ -0,0 +1,185 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+// testReceiver is a Receiver with only a name.
+type testReceiver struct {
+	Receiver
+	name string
+}
+
+func (tr *testReceiver) ConnectedTo() string {
+	return tr.name
+}
+
+// sendReceiver is a testReceiver that records sent content or fails to send it.
+type sendReceiver struct {
+	testReceiver
+	err  error
+	sent []string
+}
+
+func (sr *sendReceiver) SendContent(_, _ string, content []byte, _ *message.Logger) error {
+	if sr.err != nil {
+		return sr.err
+	}
+	sr.sent = append(sr.sent, string(content))
+	return nil
+}
+
+func newTestMultiplexer(clients ...Receiver) *Multiplexer {
+	logger := zerolog.Nop()
+	return &Multiplexer{
+		flags:   flags.NewSet(),
+		logger:  &logger,
+		server:  &testReceiver{name: "server"},
+		clients: clients,
+		pending: make(map[string]*pendingRequest),
+	}
+}
+
+func TestMultiplexer_RewriteClientContent(t *testing.T) {
+	client1 := &testReceiver{name: "client-1"}
+	client2 := &testReceiver{name: "client-2"}
+	for _, test := range []struct {
+		name     string
+		clients  []Receiver
+		client   Receiver
+		pending  string
+		content  string
+		expected string
+	}{
+		{
+			name: "single client", clients: []Receiver{client1}, client: client1,
+			content:  `{"id":1,"method":"textDocument/hover"}`,
+			expected: `{"id":1,"method":"textDocument/hover"}`,
+		},
+		{
+			name: "number ID", clients: []Receiver{client1, client2}, client: client1,
+			content:  `{"id":1,"method":"textDocument/hover"}`,
+			expected: `{"id":"client-1/1","method":"textDocument/hover"}`,
+		},
+		{
+			name: "string ID", clients: []Receiver{client1, client2}, client: client2,
+			content:  `{"id":"abc","method":"textDocument/hover"}`,
+			expected: `{"id":"client-2/abc","method":"textDocument/hover"}`,
+		},
+		{
+			name: "notification", clients: []Receiver{client1, client2}, client: client1,
+			content:  `{"method":"textDocument/didOpen","params":{}}`,
+			expected: `{"method":"textDocument/didOpen","params":{}}`,
+		},
+		{
+			name: "response", clients: []Receiver{client1, client2}, client: client1,
+			content:  `{"id":3,"result":null}`,
+			expected: `{"id":3,"result":null}`,
+		},
+		{
+			name: "cancel pending", clients: []Receiver{client1, client2}, client: client2,
+			pending:  `"client-2/4"`,
+			content:  `{"method":"$/cancelRequest","params":{"id":4}}`,
+			expected: `{"method":"$/cancelRequest","params":{"id":"client-2/4"}}`,
+		},
+		{
+			name: "cancel unknown", clients: []Receiver{client1, client2}, client: client2,
+			content:  `{"method":"$/cancelRequest","params":{"id":4}}`,
+			expected: `{"method":"$/cancelRequest","params":{"id":4}}`,
+		},
+		{
+			name: "not JSON", clients: []Receiver{client1, client2}, client: client1,
+			content:  `{"id":`,
+			expected: `{"id":`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mux := newTestMultiplexer(test.clients...)
+			if test.pending != "" {
+				mux.pending[test.pending] = &pendingRequest{client: test.client}
+			}
+			wire := mux.rewriteClientContent(test.client, []byte(test.content))
+			if json.Valid([]byte(test.expected)) {
+				assert.JSONEq(t, test.expected, string(wire))
+			} else {
+				assert.Equal(t, test.expected, string(wire))
+			}
+			assert.Equal(t, test.client, mux.recent)
+		})
+	}
+}
+
+func TestMultiplexer_RouteServerContent(t *testing.T) {
+	client1 := &testReceiver{name: "client-1"}
+	client2 := &testReceiver{name: "client-2"}
+	mux := newTestMultiplexer(client1, client2)
+	mux.rewriteClientContent(client1, []byte(`{"id":1,"method":"textDocument/hover"}`))
+	mux.rewriteClientContent(client2, []byte(`{"id":1,"method":"textDocument/hover"}`))
+	for _, test := range []struct {
+		name     string
+		content  string
+		targets  []Receiver
+		expected string
+	}{
+		{
+			name:     "response to client-1",
+			content:  `{"id":"client-1/1","result":"one"}`,
+			targets:  []Receiver{client1},
+			expected: `{"id":1,"result":"one"}`,
+		},
+		{
+			// The response has already been routed so it goes to the most recent client.
+			name:     "repeated response",
+			content:  `{"id":"client-1/1","result":"one"}`,
+			targets:  []Receiver{client2},
+			expected: `{"id":"client-1/1","result":"one"}`,
+		},
+		{
+			name:     "response to client-2",
+			content:  `{"id":"client-2/1","result":"two"}`,
+			targets:  []Receiver{client2},
+			expected: `{"id":1,"result":"two"}`,
+		},
+		{
+			name:     "notification",
+			content:  `{"method":"window/logMessage","params":{}}`,
+			targets:  []Receiver{client1, client2},
+			expected: `{"method":"window/logMessage","params":{}}`,
+		},
+		{
+			name:     "server request",
+			content:  `{"id":7,"method":"workspace/configuration","params":{}}`,
+			targets:  []Receiver{client2},
+			expected: `{"id":7,"method":"workspace/configuration","params":{}}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			targets, content := mux.routeServerContent([]byte(test.content))
+			assert.Equal(t, test.targets, targets)
+			assert.JSONEq(t, test.expected, string(content))
+		})
+	}
+	assert.Empty(t, mux.pending)
+}
+
+func TestMultiplexer_FromServer(t *testing.T) {
+	closed := errors.New("closed")
+	client1 := &sendReceiver{testReceiver: testReceiver{name: "client-1"}, err: closed}
+	client2 := &sendReceiver{testReceiver: testReceiver{name: "client-2"}}
+	client3 := &sendReceiver{testReceiver: testReceiver{name: "client-3"}}
+	mux := newTestMultiplexer(client1, client2, client3)
+	notification := `{"method":"window/logMessage","params":{}}`
+	err := mux.FromServer([]byte(notification))
+	assert.ErrorIs(t, err, closed)
+	assert.ErrorContains(t, err, "send to client-1")
+	assert.Equal(t, []string{notification}, client2.sent)
+	assert.Equal(t, []string{notification}, client3.sent)
+}
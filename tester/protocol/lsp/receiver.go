@@ -1,28 +1,132 @@
 package lsp
 
 import (
+	"sync"
+	"time"
+
 	"github.com/madkins23/lsp-tester/tester/data"
 	"github.com/madkins23/lsp-tester/tester/message"
 )
 
 var (
-	receivers = make(map[string]Receiver)
+	receivers     = make(map[string]Receiver)
+	receiversLock sync.RWMutex
+	interceptor   Interceptor
+	rewriter      Rewriter
+	faulter       Faulter
 )
 
 func GetReceiver(name string) Receiver {
+	receiversLock.RLock()
+	defer receiversLock.RUnlock()
 	return receivers[name]
 }
 
+// Receivers returns a copy of the current Receivers by name.
 func Receivers() map[string]Receiver {
-	return receivers
+	receiversLock.RLock()
+	defer receiversLock.RUnlock()
+	snapshot := make(map[string]Receiver, len(receivers))
+	for name, rcvr := range receivers {
+		snapshot[name] = rcvr
+	}
+	return snapshot
+}
+
+// ReceiverCount returns the number of current Receivers.
+func ReceiverCount() int {
+	receiversLock.RLock()
+	defer receiversLock.RUnlock()
+	return len(receivers)
+}
+
+func addReceiver(name string, rcvr Receiver) {
+	receiversLock.Lock()
+	defer receiversLock.Unlock()
+	receivers[name] = rcvr
+}
+
+func removeReceiver(name string) {
+	receiversLock.Lock()
+	defer receiversLock.Unlock()
+	delete(receivers, name)
+}
+
+// SetRewriter sets the Rewriter for messages forwarded between Receivers.
+// This should be done before any Receiver is started.
+func SetRewriter(r Rewriter) {
+	rewriter = r
+}
+
+// SetFaulter sets the Faulter for messages forwarded between Receivers.
+// This should be done before any Receiver is started.
+func SetFaulter(f Faulter) {
+	faulter = f
+}
+
+// SetInterceptor sets the Interceptor for messages forwarded between Receivers.
+// This should be done before any Receiver is started.
+func SetInterceptor(i Interceptor) {
+	interceptor = i
 }
 
 type Receiver interface {
 	Handler
 	ConnectedTo() string
+	Exit() error
+	Initialize(params data.AnyMap) (data.AnyMap, error)
+	Notify(method string, params any) error
 	Receive(ready *chan bool)
+	Request(method string, params any, timeout time.Duration) (data.AnyMap, error)
 	SendContent(from, to string, content []byte, msgLogger *message.Logger) error
 	SendMessage(to string, message data.AnyMap, msgLogger *message.Logger) error
+	SendMessageWithID(to string, message data.AnyMap, msgLogger *message.Logger) error
+	SetMultiplexer(mux *Multiplexer)
 	SetOther(other Receiver)
+	SetResponder(responder Responder)
 	Start() error
+	WriteContent(content []byte) error
+}
+
+// Responder generates responses to requests received by a Receiver
+// that has no other Receiver to which the requests can be forwarded.
+type Responder interface {
+	// Respond returns a response to the specified request or false if there is none.
+	// The response need not contain the JSON RPC version or request ID.
+	Respond(request data.AnyMap) (data.AnyMap, bool)
+}
+
+// Rewriter may change or drop messages forwarded from one Receiver to another.
+// Messages are rewritten after the Multiplexer has routed them,
+// so request IDs are those of the client connection.
+type Rewriter interface {
+	// Rewrite returns the content forwarded from the named Receiver to the other named Receiver
+	// or false if the message is to be dropped.
+	Rewrite(from, to string, content []byte) ([]byte, bool)
+}
+
+// Interceptor may hold messages forwarded from one Receiver to another.
+type Interceptor interface {
+	// Intercept returns true if the content received from the named Receiver is held.
+	// A held message is later sent (possibly more than once) using the forward function.
+	// The content must be copied if it is held.
+	Intercept(from string, content []byte, forward func(content []byte) error) bool
+}
+
+// Faulter may delay, drop, reorder, or corrupt messages forwarded from one Receiver to another.
+type Faulter interface {
+	// Fault sends the content received from the named Receiver via the Link,
+	// possibly later, out of order, corrupted, or not at all.
+	// The content must be copied if it is used after Fault returns.
+	Fault(from string, content []byte, link Link)
+}
+
+// Link sends content from one Receiver toward its destination.
+type Link interface {
+	// Forward sends content to the destination as it would be sent without faults.
+	Forward(content []byte) error
+	// WriteFrame writes raw bytes (including any header) to the destination without logging.
+	WriteFrame(frame []byte) error
+	// Close closes the connection to the destination.
+	Close() error
 }
@@ -18,8 +18,13 @@ func NewTerminator() app.SubSystem {
 
 func (t *Terminator) Shutdown() error {
 	log.Info().Str("svc", "Receivers").Msg("Shutdown")
-	errs := make([]error, len(receivers))
-	for key, rcvr := range receivers {
+	// Exit may take a while so work from a copy while Receivers finish.
+	rcvrs := Receivers()
+	errs := make([]error, 0, len(rcvrs))
+	for key, rcvr := range rcvrs {
+		if err := rcvr.Exit(); err != nil {
+			errs = append(errs, fmt.Errorf("exit handshake %s: %w", key, err))
+		}
 		if err := rcvr.Kill(); err != nil {
 			errs = append(errs, fmt.Errorf("killing receiver %s: %w", key, err))
 		}
@@ -0,0 +1,80 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+)
+
+type Listener struct {
+	flags    *flags.Set
+	listener net.Listener
+	waiter   *sync.WaitGroup
+}
+
+func NewListener(flags *flags.Set, waiter *sync.WaitGroup) (*Listener, error) {
+	listener := &Listener{
+		flags:  flags,
+		waiter: waiter,
+	}
+	if err := removeStaleSocket(flags.ClientPipe()); err != nil {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+	var err error
+	if listener.listener, err = net.Listen("unix", flags.ClientPipe()); err != nil {
+		return nil, fmt.Errorf("open listener socket: %w", err)
+	}
+	return listener, nil
+}
+
+func (l *Listener) ListenForClient(ready chan bool, configureFn func(conn net.Conn)) {
+	log.Info().Str("path", l.flags.ClientPipe()).Msg("Listener starting")
+	defer log.Info().Str("path", l.flags.ClientPipe()).Msg("Listener finished")
+
+	l.waiter.Add(1)
+	defer l.waiter.Done()
+
+	ready <- true // Signal caller waiter has been added.
+
+	for {
+		if conn, err := l.listener.Accept(); err == nil {
+			configureFn(conn)
+		} else if errors.Is(err, net.ErrClosed) {
+			break
+		} else {
+			log.Warn().Err(err).Msg("Listener accept")
+		}
+	}
+}
+
+// Close closes the listener, which also removes the socket file.
+func (l *Listener) Close() {
+	if l.listener != nil {
+		_ = l.listener.Close()
+	}
+}
+
+// removeStaleSocket removes a socket file left behind by a previous run.
+// Other kinds of files are not removed so that listening on them will fail.
+func removeStaleSocket(path string) error {
+	if stat, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("stat %s: %w", path, err)
+	} else if stat.Mode()&fs.ModeSocket == 0 {
+		return nil
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %s is in use", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,16 @@
+package pipe
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+)
+
+func ConnectToLSP(flags *flags.Set) (net.Conn, error) {
+	if connection, err := net.Dial("unix", flags.ServerPipe()); err != nil {
+		return nil, fmt.Errorf("dial socket path: %w", err)
+	} else {
+		return connection, nil
+	}
+}
@@ -0,0 +1,136 @@
+package reverse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/madkins23/go-utils/app"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+	"github.com/madkins23/lsp-tester/tester/protocol/sub"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+// PortPlaceholder is replaced by the listening port in the -command arguments.
+// If no argument contains the placeholder the argument "--socket=<port>" is added
+// as is done by the VSCode language client for TransportKind.socket.
+const PortPlaceholder = "{port}"
+
+// acceptWait is the maximum time to wait for the LSP to connect after it is launched.
+const acceptWait = 10 * time.Second
+
+// NewProcess launches the LSP command and waits for it to connect back to the tester.
+// The tester listens on the -serverPort or on any free port if that flag is not set.
+func NewProcess(to string, flags *flags.Set,
+	msgLgr *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) (lsp.Receiver, error) {
+	//
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", flags.HostAddress(), flags.ServerPort()))
+	if err != nil {
+		return nil, fmt.Errorf("open listener connection: %w", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	path, args := flags.Command()
+	args = portArgs(args, port)
+	log.Debug().Str("path", path).Strs("args", args).Int("port", port).Msg("execute command")
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, path, args...)
+	sub.CaptureStderr(cmd)
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("run command: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		log.Info().Err(err).Str("path", path).Msg("Command finished")
+		exited <- err
+	}()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	select {
+	case conn := <-accepted:
+		log.Info().Str("remote", conn.RemoteAddr().String()).Msg("Accepted LSP connection")
+		return lsp.NewReceiver(to, flags, NewHandler(conn, cancel), msgLgr, waiter, terminator), nil
+	case err := <-exited:
+		cancel()
+		if err == nil {
+			err = errors.New("command exited")
+		}
+		return nil, fmt.Errorf("wait for LSP connection on port %d: %w", port, err)
+	case <-time.After(acceptWait):
+		cancel()
+		return nil, fmt.Errorf("no LSP connection on port %d after %s", port, acceptWait)
+	}
+}
+
+// portArgs returns the command arguments with the port substituted for the PortPlaceholder.
+func portArgs(args []string, port int) []string {
+	portStr := strconv.Itoa(port)
+	result := make([]string, len(args), len(args)+1)
+	found := false
+	for i, arg := range args {
+		if strings.Contains(arg, PortPlaceholder) {
+			arg = strings.ReplaceAll(arg, PortPlaceholder, portStr)
+			found = true
+		}
+		result[i] = arg
+	}
+	if !found {
+		result = append(result, "--socket="+portStr)
+	}
+	return result
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+var _ lsp.Handler = (*Handler)(nil)
+
+// Handler communicates over the connection made by the LSP to the tester.
+// Killing the Handler also kills the LSP process.
+type Handler struct {
+	connection net.Conn
+	reader     *bufio.Reader
+	writer     io.Writer
+	cancel     context.CancelFunc
+}
+
+func NewHandler(connection net.Conn, cancel context.CancelFunc) *Handler {
+	return &Handler{
+		connection: connection,
+		reader:     bufio.NewReader(connection),
+		writer:     connection,
+		cancel:     cancel,
+	}
+}
+
+func (h *Handler) Reader() *bufio.Reader {
+	return h.reader
+}
+
+func (h *Handler) Writer() io.Writer {
+	return h.writer
+}
+
+func (h *Handler) Kill() error {
+	h.cancel()
+	return h.connection.Close()
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"os/exec"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/madkins23/go-utils/app"
 	"github.com/rs/zerolog/log"
@@ -19,36 +21,40 @@ import (
 
 var _ lsp.Receiver = (*ProcessReceiver)(nil)
 
+// restarts counts the number of times the server process has been restarted.
+var restarts atomic.Uint64
+
+// Restarts returns the number of times the server process has been restarted.
+func Restarts() uint64 {
+	return restarts.Load()
+}
+
 type ProcessReceiver struct {
 	*lsp.ReceiverBase
-	cmd *exec.Cmd
+	handler *ProcessHandler
 }
 
 func NewProcess(to string, flags *flags.Set,
 	msgLgr *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) (lsp.Receiver, error) {
 	//
-	ctx, cancel := context.WithCancel(context.Background())
-	path, args := flags.Command()
-	log.Debug().Str("path", path).Strs("args", args).Msg("execute command")
-	cmd := exec.CommandContext(ctx, path, args...)
-	procStdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("stdin pipe: %w", err)
+	handler := &ProcessHandler{flags: flags}
+	if err := handler.command(); err != nil {
+		return nil, err
 	}
-	procStdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("stdout pipe: %w", err)
+	if flags.Restarts() > 0 {
+		// Observe messages to the server so that they can be replayed after a restart.
+		handler.supervisor = NewSupervisor(flags, msgLgr)
+		msgLgr.AddObserver(handler.supervisor)
 	}
 
 	return &ProcessReceiver{
-		ReceiverBase: lsp.NewReceiver(
-			to, flags, NewProcessHandler(procStdin, procStdout, cancel), msgLgr, waiter, terminator),
-		cmd: cmd,
+		ReceiverBase: lsp.NewReceiver(to, flags, handler, msgLgr, waiter, terminator),
+		handler:      handler,
 	}, nil
 }
 
 func (pr *ProcessReceiver) Start() error {
-	if err := pr.cmd.Start(); err != nil {
+	if err := pr.handler.start(); err != nil {
 		return fmt.Errorf("run command: %w", err)
 	} else {
 		return pr.ReceiverBase.Start()
@@ -57,31 +63,135 @@ func (pr *ProcessReceiver) Start() error {
 
 ///////////////////////////////////////////////////////////////////////////////
 
-var _ lsp.Handler = (*ProcessHandler)(nil)
+var (
+	_ lsp.Handler   = (*ProcessHandler)(nil)
+	_ lsp.Restarter = (*ProcessHandler)(nil)
+)
 
+// ProcessHandler communicates with an LSP sub-process via its standard input and output.
+// If there is a Supervisor the sub-process is restarted when it exits unexpectedly.
 type ProcessHandler struct {
-	writer io.Writer
-	reader *bufio.Reader
-	cancel context.CancelFunc
-}
-
-func NewProcessHandler(input io.Writer, output io.Reader, cancel context.CancelFunc) *ProcessHandler {
-	return &ProcessHandler{
-		writer: input,
-		reader: bufio.NewReader(output),
-		cancel: cancel,
-	}
+	flags      *flags.Set
+	cmd        *exec.Cmd
+	writer     io.Writer
+	reader     *bufio.Reader
+	cancel     context.CancelFunc
+	supervisor *Supervisor
+	started    time.Time
+	killed     atomic.Bool
+	// relaunched counts the successful restarts so that writes held during a restart can be recognized.
+	relaunched atomic.Uint64
+	// procLock guards cmd and cancel which are replaced when the sub-process is restarted.
+	procLock sync.Mutex
+	// writeLock holds writes to the sub-process while it is being restarted.
+	writeLock sync.Mutex
 }
 
 func (h *ProcessHandler) Reader() *bufio.Reader {
 	return h.reader
 }
 
+// Writer returns the ProcessHandler so that writes can be held during a restart.
 func (h *ProcessHandler) Writer() io.Writer {
-	return h.writer
+	return h
+}
+
+// Write writes a frame to the sub-process.
+// Document notifications held during a restart are dropped
+// if they are already reflected in the documents replayed to the restarted server.
+func (h *ProcessHandler) Write(frame []byte) (int, error) {
+	relaunched := h.relaunched.Load()
+	h.writeLock.Lock()
+	defer h.writeLock.Unlock()
+	if relaunched != h.relaunched.Load() && h.supervisor.stale(frame) {
+		log.Debug().Str("for", "supervisor").Msg("Drop document notification held during restart")
+		return len(frame), nil
+	}
+	return h.writer.Write(frame)
 }
 
+// Kill terminates the sub-process and prevents any further restarts.
+// A process started by a restart already in progress is terminated by the restart.
 func (h *ProcessHandler) Kill() error {
+	h.killed.Store(true)
+	h.cancelProcess()
+	return nil
+}
+
+// Restart restarts the sub-process if there is a Supervisor and the exit was unexpected.
+func (h *ProcessHandler) Restart() bool {
+	if h.supervisor == nil || h.killed.Load() {
+		return false
+	}
+	pending := h.supervisor.takePending()
+	h.writeLock.Lock()
+	defer h.writeLock.Unlock()
+	if !h.supervisor.restart(h, pending) {
+		return false
+	}
+	h.relaunched.Add(1)
+	return true
+}
+
+// command creates the sub-process command connected to the handler.
+func (h *ProcessHandler) command() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	path, args := h.flags.Command()
+	log.Debug().Str("path", path).Strs("args", args).Msg("execute command")
+	cmd := exec.CommandContext(ctx, path, args...)
+	procStdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return fmt.Errorf("stdin pipe: %w", err)
+	}
+	procStdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+	CaptureStderr(cmd)
+
+	h.procLock.Lock()
+	defer h.procLock.Unlock()
+	h.cmd = cmd
+	h.writer = procStdin
+	h.reader = bufio.NewReader(procStdout)
+	h.cancel = cancel
+	return nil
+}
+
+// cancelProcess terminates the current sub-process.
+func (h *ProcessHandler) cancelProcess() {
+	h.procLock.Lock()
+	defer h.procLock.Unlock()
 	h.cancel()
+}
+
+// start starts the sub-process command.
+func (h *ProcessHandler) start() error {
+	if err := h.cmd.Start(); err != nil {
+		h.cancelProcess()
+		return err
+	}
+	h.started = time.Now()
 	return nil
 }
+
+// wait waits for the sub-process to finish and returns how long it ran.
+func (h *ProcessHandler) wait() (*exitState, time.Duration) {
+	_ = h.cmd.Wait()
+	state := &exitState{code: -1, description: "unknown"}
+	if h.cmd.ProcessState != nil {
+		state.code = h.cmd.ProcessState.ExitCode()
+		state.description = h.cmd.ProcessState.String()
+	}
+	return state, time.Since(h.started)
+}
+
+// exitState describes how the sub-process finished.
+type exitState struct {
+	// code is the exit code or -1 if the process was terminated by a signal.
+	code int
+	// description is the exit status or signal (e.g. "signal: killed").
+	description string
+}
@@ -0,0 +1,129 @@
+package sub
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+)
+
+// stderrLines is the number of recent lines kept for the web server.
+const stderrLines = 1000
+
+// stderr is the Stderr used by CaptureStderr.
+var stderr *Stderr
+
+// SetStderr sets the Stderr used for LSP sub-processes.
+// This should be done before any sub-process is started.
+func SetStderr(s *Stderr) {
+	stderr = s
+}
+
+// CaptureStderr connects the standard error of the command to the Stderr, if any.
+// This must be done before the command is started.
+func CaptureStderr(cmd *exec.Cmd) {
+	if stderr != nil {
+		cmd.Stderr = stderr
+	}
+}
+
+// Stderr captures the standard error output of LSP sub-processes line by line.
+// Each line is logged, kept for the web server, and optionally written to a file.
+type Stderr struct {
+	logger  *zerolog.Logger
+	file    *os.File
+	partial []byte
+	lines   []*StderrLine
+	next    int
+	lock    sync.Mutex
+}
+
+// StderrLine is a single line of standard error output.
+type StderrLine struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// NewStderr returns a new Stderr which writes to the -stderrFile, if any.
+func NewStderr(flags *flags.Set) (*Stderr, error) {
+	logger := log.With().Str("for", "server-stderr").Logger()
+	s := &Stderr{
+		logger: &logger,
+		lines:  make([]*StderrLine, 0, stderrLines),
+	}
+	if path := flags.StderrFile(); path != "" {
+		var err error
+		if s.file, err = os.Create(path); err != nil {
+			return nil, fmt.Errorf("create stderr file %s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// Close writes any partial line and closes the file, if any.
+func (s *Stderr) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.partial) > 0 {
+		s.line(s.partial)
+		s.partial = nil
+	}
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			s.logger.Warn().Err(err).Msg("Close stderr file")
+		}
+		s.file = nil
+	}
+}
+
+// Write splits the output into lines.
+// Any partial line is kept until the rest of it is written.
+func (s *Stderr) Write(output []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.partial = append(s.partial, output...)
+	for {
+		end := bytes.IndexByte(s.partial, '\n')
+		if end < 0 {
+			break
+		}
+		s.line(s.partial[:end])
+		s.partial = s.partial[end+1:]
+	}
+	return len(output), nil
+}
+
+// Lines returns the most recent lines in order.
+func (s *Stderr) Lines() []*StderrLine {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	lines := make([]*StderrLine, 0, len(s.lines))
+	lines = append(lines, s.lines[s.next:]...)
+	return append(lines, s.lines[:s.next]...)
+}
+
+// line handles a single line without its newline.
+// Must be called with the lock held.
+func (s *Stderr) line(text []byte) {
+	text = bytes.TrimRight(text, "\r")
+	line := &StderrLine{Time: time.Now(), Text: string(text)}
+	s.logger.Info().Msg(line.Text)
+	if len(s.lines) < stderrLines {
+		s.lines = append(s.lines, line)
+	} else {
+		s.lines[s.next] = line
+		s.next = (s.next + 1) % stderrLines
+	}
+	if s.file != nil {
+		if _, err := s.file.WriteString(line.Text + "\n"); err != nil {
+			s.logger.Warn().Err(err).Msg("Write stderr file")
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package sub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+const (
+	// restartDelay is the delay before the first restart, doubled after each failed restart.
+	restartDelay = 500 * time.Millisecond
+	// restartDelayMax is the maximum delay before a restart.
+	restartDelayMax = 30 * time.Second
+	// restartStable is how long a server must run before earlier failures are forgotten.
+	restartStable = time.Minute
+	// restartTimeout is how long to wait for the restarted server to respond to initialize.
+	restartTimeout = 10 * time.Second
+	// exitWait is how long to wait for a server to exit after its output is closed.
+	exitWait = 5 * time.Second
+	// requestFailed is the LSP error code for requests pending when the server crashed.
+	requestFailed = -32803
+)
+
+var _ message.Observer = (*Supervisor)(nil)
+
+// errKilled is returned by relaunch if the handler was killed during the restart.
+var errKilled = errors.New("killed during restart")
+
+// Supervisor restarts a crashed LSP sub-process.
+// It observes the messages sent to the server so that the initialize handshake
+// can be replayed to the restarted server followed by a didOpen notification
+// with the current text of each document open in the message.Documents mirror.
+// Client requests pending when the server crashed are answered with a RequestFailed error.
+type Supervisor struct {
+	flags       *flags.Set
+	msgLgr      *message.Logger
+	logger      *zerolog.Logger
+	initialize  []byte
+	initialized []byte
+	// pending contains the client requests that have not been answered by the server.
+	pending map[string]*pendingRequest
+	// replayed contains the version of each document replayed to the restarted server by URI.
+	replayed map[string]int
+	// exiting is true after the shutdown request or exit notification has been sent.
+	exiting bool
+	// restarted is the number of restarts so far.
+	restarted uint
+	// failures is the number of restarts since the server was last stable.
+	failures  uint
+	replaying atomic.Bool
+	lock      sync.Mutex
+}
+
+func NewSupervisor(flags *flags.Set, msgLgr *message.Logger) *Supervisor {
+	logger := log.With().Str("for", "supervisor").Logger()
+	return &Supervisor{
+		flags:   flags,
+		msgLgr:  msgLgr,
+		logger:  &logger,
+		pending: make(map[string]*pendingRequest),
+	}
+}
+
+// pendingRequest is a client request that has not been answered by the server.
+type pendingRequest struct {
+	client string
+	id     json.RawMessage
+	method string
+}
+
+// Observe keeps the messages sent to the server that must be replayed after a restart
+// and tracks the client requests that have not been answered.
+func (s *Supervisor) Observe(entry *message.Entry) {
+	if entry.From == "server" {
+		if fields := entry.Fields(); fields.Type == message.TypeResponse {
+			s.lock.Lock()
+			delete(s.pending, pendingKey(entry.To, fields.ID))
+			s.lock.Unlock()
+		}
+		return
+	}
+	if entry.To != "server" || (entry.From == "tester" && s.replaying.Load()) {
+		return
+	}
+	fields := entry.Fields()
+	if fields.Type == message.TypeUnknown || fields.Type == message.TypeResponse {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if fields.Type == message.TypeRequest && entry.From != "tester" {
+		// Requests made by the tester time out on their own.
+		s.pending[pendingKey(entry.From, fields.ID)] = &pendingRequest{
+			client: entry.From,
+			id:     fields.ID,
+			method: fields.Method,
+		}
+	}
+	switch fields.Method {
+	case "initialize":
+		s.initialize = entry.Content
+		s.initialized = nil
+		s.exiting = false
+	case "initialized":
+		s.initialized = entry.Content
+	case "shutdown", "exit":
+		s.exiting = true
+	}
+}
+
+// restart waits for the server process to finish and restarts it unless the exit was expected.
+// The pending requests are failed before the server is restarted.
+// Returns false if the server was not restarted.
+func (s *Supervisor) restart(h *ProcessHandler, pending []*pendingRequest) bool {
+	state, uptime := s.finish(h)
+	s.lock.Lock()
+	exiting := s.exiting
+	s.lock.Unlock()
+	if exiting {
+		s.logger.Info().Int("code", state.code).Msg("Server exited")
+		return false
+	}
+	s.logger.Error().Int("code", state.code).Str("status", state.description).
+		Dur("uptime", uptime).Msg("Server crashed")
+	s.fail(pending)
+	if uptime > restartStable {
+		s.failures = 0
+	}
+
+	for {
+		if s.restarted >= s.flags.Restarts() {
+			s.logger.Error().Uint("restarts", s.restarted).Msg("Restart limit reached")
+			return false
+		}
+		delay := restartDelay << s.failures
+		if delay > restartDelayMax || delay <= 0 {
+			delay = restartDelayMax
+		}
+		s.failures++
+		s.logger.Info().Dur("delay", delay).Msg("Restarting server")
+		time.Sleep(delay)
+		if h.killed.Load() {
+			return false
+		}
+
+		s.restarted++
+		restarts.Add(1)
+		err := s.relaunch(h)
+		if err == nil && !h.killed.Load() {
+			s.logger.Info().Uint("restarts", s.restarted).Msg("Server restarted")
+			return true
+		}
+		h.cancelProcess()
+		if err == nil || h.killed.Load() {
+			// Terminated during restart.
+			return false
+		}
+		s.logger.Error().Err(err).Msg("Restart server")
+		_, _ = s.finish(h)
+	}
+}
+
+// takePending returns the requests pending on the crashed server and stops tracking them.
+// Requests sent after this are held until the restart is done and sent to the restarted server.
+func (s *Supervisor) takePending() []*pendingRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pending := make([]*pendingRequest, 0, len(s.pending))
+	for _, request := range s.pending {
+		pending = append(pending, request)
+	}
+	s.pending = make(map[string]*pendingRequest)
+	return pending
+}
+
+// fail sends a RequestFailed error response to the client for each pending request
+// as the crashed server will never respond and the restarted server never received them.
+func (s *Supervisor) fail(pending []*pendingRequest) {
+	for _, request := range pending {
+		client := lsp.GetReceiver(request.client)
+		if client == nil {
+			continue
+		}
+		content, err := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      request.id,
+			"error": map[string]any{
+				"code":    requestFailed,
+				"message": "Server crashed before responding to " + request.method,
+			},
+		})
+		if err != nil {
+			s.logger.Warn().Err(err).Msg("Marshal failed response")
+		} else if err := client.SendContent("tester", request.client, content, s.msgLgr); err != nil {
+			s.logger.Warn().Err(err).Str("client", request.client).Msg("Send failed response")
+		}
+	}
+	if len(pending) > 0 {
+		s.logger.Info().Int("requests", len(pending)).Msg("Pending requests failed")
+	}
+}
+
+// finish waits for the server process to exit after its output has been closed,
+// killing it if it doesn't exit promptly.
+func (s *Supervisor) finish(h *ProcessHandler) (*exitState, time.Duration) {
+	type result struct {
+		state  *exitState
+		uptime time.Duration
+	}
+	done := make(chan result, 1)
+	go func() {
+		state, uptime := h.wait()
+		done <- result{state, uptime}
+	}()
+	select {
+	case r := <-done:
+		h.cancelProcess()
+		return r.state, r.uptime
+	case <-time.After(exitWait):
+		s.logger.Warn().Msg("Server output closed but process still running, killing it")
+		h.cancelProcess()
+		r := <-done
+		return r.state, r.uptime
+	}
+}
+
+// relaunch starts a new server process and replays the initialize handshake and open documents.
+// Replayed messages are written directly to the new process as the handler write lock is held.
+// Each open document is replayed as a single didOpen with its current text
+// so that notifications held during the restart must be checked with stale.
+func (s *Supervisor) relaunch(h *ProcessHandler) error {
+	if err := h.command(); err != nil {
+		return fmt.Errorf("create command: %w", err)
+	}
+	if h.killed.Load() {
+		// Kill may have cancelled the previous process instead of the new one.
+		return errKilled
+	}
+	if err := h.start(); err != nil {
+		return fmt.Errorf("start command: %w", err)
+	}
+
+	s.replaying.Store(true)
+	defer s.replaying.Store(false)
+
+	s.lock.Lock()
+	initialize, initialized := s.initialize, s.initialized
+	s.lock.Unlock()
+
+	if initialize == nil {
+		// The client has not initialized the server yet.
+		s.setReplayed(nil)
+		return nil
+	}
+	if err := s.send(h, initialize); err != nil {
+		return fmt.Errorf("send initialize: %w", err)
+	}
+	if err := s.awaitResponse(h, (&message.Entry{Content: initialize}).Fields().ID); err != nil {
+		return fmt.Errorf("await initialize: %w", err)
+	}
+	if initialized != nil {
+		if err := s.send(h, initialized); err != nil {
+			return fmt.Errorf("send initialized: %w", err)
+		}
+	}
+	documents := s.msgLgr.Documents().List()
+	s.setReplayed(documents)
+	for _, doc := range documents {
+		if content, err := didOpen(doc); err != nil {
+			return fmt.Errorf("marshal document %s: %w", doc.URI, err)
+		} else if err := s.send(h, content); err != nil {
+			return fmt.Errorf("send document %s: %w", doc.URI, err)
+		}
+	}
+	s.logger.Info().Int("documents", len(documents)).Msg("Server state replayed")
+	return nil
+}
+
+// setReplayed records the versions of the documents replayed to the restarted server.
+func (s *Supervisor) setReplayed(documents []*message.Document) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.replayed = make(map[string]int, len(documents))
+	for _, doc := range documents {
+		s.replayed[doc.URI] = doc.Version
+	}
+}
+
+// stale returns true if a frame held during a restart is a document notification
+// that is already part of the documents replayed to the restarted server:
+// a didOpen for a replayed document, a didChange up to the replayed version,
+// or a didClose for a document that was not replayed.
+func (s *Supervisor) stale(frame []byte) bool {
+	start := bytes.IndexByte(frame, '{')
+	if start < 0 {
+		return false
+	}
+	content := frame[start:]
+	method := (&message.Entry{Content: content}).Fields().Method
+	if !strings.HasPrefix(method, "textDocument/did") {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	version, replayed := s.replayed[message.DocumentURI(content)]
+	switch method {
+	case "textDocument/didOpen":
+		return replayed
+	case "textDocument/didChange":
+		var notification struct {
+			Params struct {
+				TextDocument struct {
+					Version int `json:"version"`
+				} `json:"textDocument"`
+			} `json:"params"`
+		}
+		return replayed && json.Unmarshal(content, &notification) == nil &&
+			notification.Params.TextDocument.Version <= version
+	case "textDocument/didClose":
+		return !replayed
+	}
+	return false
+}
+
+// send logs content and writes it to the server process.
+func (s *Supervisor) send(h *ProcessHandler, content []byte) error {
+	s.msgLgr.Message("tester", "server", "Send", content)
+	_, err := fmt.Fprintf(h.writer, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+// awaitResponse reads messages from the server process until the response with the specified ID.
+// Messages read from the server while waiting are logged and dropped.
+func (s *Supervisor) awaitResponse(h *ProcessHandler, id json.RawMessage) error {
+	done := make(chan error, 1)
+	go func() {
+		for {
+			content, err := readFrame(h.reader)
+			if err != nil {
+				done <- err
+				return
+			}
+			s.msgLgr.Message("server", "tester", "Rcvd", content)
+			if fields := (&message.Entry{Content: content}).Fields(); fields.Type == message.TypeResponse &&
+				string(fields.ID) == string(id) {
+				if fields.Error {
+					done <- errors.New("error response")
+				} else {
+					done <- nil
+				}
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(restartTimeout):
+		// Killing the process ends the read.
+		h.cancelProcess()
+		<-done
+		return fmt.Errorf("no response after %s", restartTimeout)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+var contentLength = regexp.MustCompile(`^Content-Length:\s*(\d+)`)
+
+// readFrame reads a single message with Content-Length header from the reader.
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == "\r\n" || line == "\n" {
+			break
+		}
+		if matches := contentLength.FindStringSubmatch(line); len(matches) > 1 {
+			if length, err = strconv.Atoi(matches[1]); err != nil {
+				return nil, fmt.Errorf("content length: %w", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("no content length")
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// pendingKey returns a key for a request from the specified client.
+// Each client has its own request IDs.
+func pendingKey(client string, id json.RawMessage) string {
+	return client + " " + string(id)
+}
+
+// didOpen returns a didOpen notification with the current text of the document.
+func didOpen(doc *message.Document) ([]byte, error) {
+	type textDocument struct {
+		URI        string `json:"uri"`
+		LanguageID string `json:"languageId"`
+		Version    int    `json:"version"`
+		Text       string `json:"text"`
+	}
+	return json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/didOpen",
+		"params": map[string]any{
+			"textDocument": &textDocument{
+				URI:        doc.URI,
+				LanguageID: doc.LanguageID,
+				Version:    doc.Version,
+				Text:       doc.Text,
+			},
+		},
+	})
+}
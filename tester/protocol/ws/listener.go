@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+)
+
+// Listener accepts WebSocket connections from browser-hosted clients on any URL path.
+type Listener struct {
+	flags    *flags.Set
+	server   *http.Server
+	upgrader websocket.Upgrader
+	waiter   *sync.WaitGroup
+}
+
+func NewListener(flags *flags.Set, waiter *sync.WaitGroup) *Listener {
+	return &Listener{
+		flags: flags,
+		server: &http.Server{
+			Addr: ":" + strconv.Itoa(int(flags.WebSocketPort())),
+		},
+		upgrader: websocket.Upgrader{
+			// Browser editors are usually served from some other origin.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		waiter: waiter,
+	}
+}
+
+func (l *Listener) ListenForClient(ready chan bool, configureFn func(conn *websocket.Conn)) {
+	log.Info().Uint("port", l.flags.WebSocketPort()).Msg("WebSocket listener starting")
+	defer log.Info().Uint("port", l.flags.WebSocketPort()).Msg("WebSocket listener finished")
+
+	l.waiter.Add(1)
+	defer l.waiter.Done()
+
+	l.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := l.upgrader.Upgrade(w, r, nil); err != nil {
+			// The upgrader has already returned an HTTP error.
+			log.Warn().Err(err).Msg("WebSocket upgrade")
+		} else {
+			configureFn(conn)
+		}
+	})
+
+	ready <- true // Signal caller waiter has been added.
+
+	if err := l.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error().Err(err).Msg("WebSocket listener")
+	}
+}
+
+func (l *Listener) Close() {
+	// Connections that have been upgraded are not affected.
+	_ = l.server.Shutdown(context.Background())
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/madkins23/go-utils/app"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+func NewReceiver(to string, flags *flags.Set, connection *websocket.Conn,
+	msgLgr *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) lsp.Receiver {
+	//
+	return lsp.NewReceiver(to, flags, NewHandler(connection), msgLgr, waiter, terminator)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+var _ lsp.Handler = (*Handler)(nil)
+
+// Handler communicates over a WebSocket connection with one JSON RPC message per frame.
+// Messages read from the connection are given Content-Length headers
+// and headers are removed from messages written to the connection
+// so that the framing is the same as for other protocols.
+type Handler struct {
+	connection *websocket.Conn
+	reader     *bufio.Reader
+	writer     *frameWriter
+}
+
+func NewHandler(connection *websocket.Conn) *Handler {
+	pipeReader, pipeWriter := io.Pipe()
+	go readFrames(connection, pipeWriter)
+	return &Handler{
+		connection: connection,
+		reader:     bufio.NewReader(pipeReader),
+		writer:     &frameWriter{connection: connection},
+	}
+}
+
+func (h *Handler) Reader() *bufio.Reader {
+	return h.reader
+}
+
+func (h *Handler) Writer() io.Writer {
+	return h.writer
+}
+
+func (h *Handler) Kill() error {
+	return h.connection.Close()
+}
+
+// readFrames copies messages from the connection to the pipe with Content-Length headers.
+// The pipe is closed when the connection is closed so that the Receiver sees the end of file.
+func readFrames(connection *websocket.Conn, pipe *io.PipeWriter) {
+	defer func() { _ = pipe.Close() }()
+	for {
+		kind, content, err := connection.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Debug().Err(err).Msg("Read WebSocket message")
+			}
+			return
+		} else if kind != websocket.TextMessage && kind != websocket.BinaryMessage {
+			continue
+		}
+		if _, err := fmt.Fprintf(pipe, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+			return
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// frameWriter writes each message to the connection as a single frame without its header.
+// The Receiver writes an entire header and message in each call to Write.
+type frameWriter struct {
+	connection *websocket.Conn
+	lock       sync.Mutex
+}
+
+var (
+	headerEnd           = []byte("\r\n\r\n")
+	contentLengthHeader = regexp.MustCompile(`Content-Length:\s*(\d+)`)
+)
+
+func (fw *frameWriter) Write(frame []byte) (int, error) {
+	content := frame
+	if end := bytes.Index(frame, headerEnd); end >= 0 {
+		content = frame[end+len(headerEnd):]
+		// A corrupt frame (e.g. from fault injection) is sent with whatever content it has.
+		if matches := contentLengthHeader.FindSubmatch(frame[:end]); len(matches) > 1 {
+			if length, err := strconv.Atoi(string(matches[1])); err == nil && length < len(content) {
+				content = content[:length]
+			}
+		}
+	}
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+	if err := fw.connection.WriteMessage(websocket.TextMessage, content); err != nil {
+		return 0, fmt.Errorf("write WebSocket message: %w", err)
+	}
+	return len(frame), nil
+}
@@ -0,0 +1,310 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/madkins23/go-utils/app"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+var _ message.Observer = (*Replayer)(nil)
+
+// Replayer plays the client side of a recorded session against an LSP server
+// and compares the responses from the server with the recorded responses.
+// The live server chooses its own IDs for requests to the client,
+// so server requests are matched to the recording by method and order
+// and recorded client responses are sent with the ID of the live request.
+type Replayer struct {
+	flags      *flags.Set
+	logger     *zerolog.Logger
+	msgLgr     *message.Logger
+	terminator *app.Terminator
+	steps      []*Step
+	recorded   map[string]*Step
+	// notifications and requests count the recorded server messages by method.
+	notifications map[string]int
+	requests      map[string]int
+	// keys contains the key of each recorded server request and response.
+	keys map[*Step]string
+	// requestKeys contains the key of each recorded server request by recorded ID.
+	requestKeys map[string]string
+	received    map[string]json.RawMessage
+	// arrived and requested count the live server notifications and requests by method.
+	arrived   map[string]int
+	requested map[string]int
+	changed   chan bool
+	lock      sync.Mutex
+}
+
+func NewReplayer(flags *flags.Set, msgLgr *message.Logger, terminator *app.Terminator) (*Replayer, error) {
+	steps, err := LoadSession(flags.ReplayPath())
+	if err != nil {
+		return nil, fmt.Errorf("load session: %w", err)
+	}
+	logger := log.With().Str("svc", "replay").Logger()
+	replayer := &Replayer{
+		flags:         flags,
+		logger:        &logger,
+		msgLgr:        msgLgr,
+		terminator:    terminator,
+		steps:         steps,
+		recorded:      make(map[string]*Step),
+		notifications: make(map[string]int),
+		requests:      make(map[string]int),
+		keys:          make(map[*Step]string),
+		requestKeys:   make(map[string]string),
+		received:      make(map[string]json.RawMessage),
+		arrived:       make(map[string]int),
+		requested:     make(map[string]int),
+		changed:       make(chan bool, 1),
+	}
+	for _, step := range steps {
+		if step.ToServer {
+			continue
+		}
+		var key string
+		if step.IsRequest() {
+			replayer.requests[step.Method]++
+			key = requestKey(step.Method, replayer.requests[step.Method])
+			replayer.requestKeys[string(step.ID)] = key
+		} else if step.Method != "" {
+			replayer.notifications[step.Method]++
+		} else {
+			key = responseKey(step.ID)
+		}
+		if key != "" {
+			replayer.keys[step] = key
+			replayer.recorded[key] = step
+		}
+	}
+	return replayer, nil
+}
+
+// Observe tracks messages received from the server.
+func (r *Replayer) Observe(entry *message.Entry) {
+	if entry.From != "server" {
+		return
+	}
+	var flds fields
+	if err := json.Unmarshal(entry.Content, &flds); err != nil {
+		r.logger.Warn().Err(err).Msg("Unmarshal server message")
+		return
+	}
+	if string(flds.ID) == "null" {
+		flds.ID = nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := responseKey(flds.ID)
+	if flds.Method != "" {
+		if key == "" {
+			r.arrived[flds.Method]++
+		} else {
+			r.requested[flds.Method]++
+			key = requestKey(flds.Method, r.requested[flds.Method])
+		}
+	}
+	if key != "" {
+		r.received[key] = entry.Content
+		select {
+		case r.changed <- true:
+		default:
+		}
+	}
+}
+
+// Run sends each client message from the recorded session to the server in the original order.
+// Before each message is sent any responses or requests from the server that
+// preceded the message in the recorded session are awaited.
+// When all messages have been sent and all responses received (or timed out)
+// a summary is logged and the application is shut down.
+func (r *Replayer) Run(server lsp.Receiver) {
+	r.logger.Info().Int("steps", len(r.steps)).Str("file", r.flags.ReplayPath()).Msg("Replay starting")
+	defer r.logger.Info().Msg("Replay finished")
+
+	start := time.Now()
+	var first time.Time
+	awaited := make([]string, 0)
+	expected := make([]string, 0)
+	for _, step := range r.steps {
+		if !step.ToServer {
+			if key, found := r.keys[step]; found {
+				awaited = append(awaited, key)
+			}
+			continue
+		}
+		r.await(awaited)
+		awaited = awaited[:0]
+		if first.IsZero() {
+			first = step.Time
+		} else if r.flags.ReplayTiming() {
+			if delay := step.Time.Sub(first) - time.Since(start); delay > 0 {
+				time.Sleep(delay)
+			}
+		}
+		content := step.Content
+		if step.IsRequest() {
+			expected = append(expected, responseKey(step.ID))
+		} else if step.IsResponse() {
+			var found bool
+			if content, found = r.liveResponse(step); !found {
+				r.logger.Warn().RawJSON("id", step.ID).Msg("No server request for recorded response")
+				continue
+			}
+		}
+		if err := server.SendContent("tester", server.ConnectedTo(), content, r.msgLgr); err != nil {
+			r.logger.Error().Err(err).Msg("Send replay message")
+			break
+		}
+	}
+	r.await(expected)
+	r.summarize()
+
+	if err := r.terminator.Shutdown(); err != nil {
+		r.logger.Error().Err(err).Msg("Terminating")
+	}
+}
+
+// await waits until all the specified keys have been received from the server
+// or until the -replayWait time has elapsed without receiving anything.
+func (r *Replayer) await(keys []string) {
+	for {
+		if r.missing(keys) == 0 {
+			return
+		}
+		select {
+		case <-r.changed:
+		case <-time.After(r.flags.ReplayWait()):
+			r.logger.Warn().Int("missing", r.missing(keys)).Msg("Timed out waiting for server")
+			return
+		}
+	}
+}
+
+// liveResponse returns the content of a recorded client response to a server request
+// with the ID of the matching server request from the live server.
+// Returns false if the live server has not sent the matching request.
+func (r *Replayer) liveResponse(step *Step) (json.RawMessage, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	request, found := r.received[r.requestKeys[string(step.ID)]]
+	if !found {
+		return nil, false
+	}
+	var live, response map[string]json.RawMessage
+	if err := json.Unmarshal(request, &live); err != nil {
+		return nil, false
+	} else if err := json.Unmarshal(step.Content, &response); err != nil {
+		return nil, false
+	}
+	response["id"] = live["id"]
+	content, err := json.Marshal(response)
+	if err != nil {
+		r.logger.Warn().Err(err).Msg("Marshal response")
+		return nil, false
+	}
+	return content, true
+}
+
+func (r *Replayer) missing(keys []string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var missing int
+	for _, key := range keys {
+		if _, found := r.received[key]; !found {
+			missing++
+		}
+	}
+	return missing
+}
+
+func (r *Replayer) summarize() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var requests, matched, mismatched, missing, unexpected int
+	for _, step := range r.steps {
+		if !step.ToServer || !step.IsRequest() {
+			continue
+		}
+		requests++
+		key := responseKey(step.ID)
+		actual, found := r.received[key]
+		if !found {
+			missing++
+			r.logger.Warn().RawJSON("id", step.ID).Str("method", step.Method).Msg("Missing response")
+		} else if recorded, found := r.recorded[key]; !found {
+			r.logger.Debug().RawJSON("id", step.ID).Str("method", step.Method).Msg("No recorded response")
+		} else if same, err := sameResponse(recorded.Content, actual); err != nil {
+			r.logger.Warn().Err(err).RawJSON("id", step.ID).Msg("Compare responses")
+		} else if same {
+			matched++
+		} else {
+			mismatched++
+			r.logger.Warn().RawJSON("id", step.ID).Str("method", step.Method).
+				RawJSON("expected", recorded.Content).RawJSON("actual", actual).Msg("Response mismatch")
+		}
+	}
+	for method, count := range r.arrived {
+		if extra := count - r.notifications[method]; extra > 0 {
+			unexpected += extra
+			r.logger.Warn().Str("method", method).Int("count", extra).Msg("Unexpected notification")
+		}
+	}
+	for method, count := range r.requested {
+		if extra := count - r.requests[method]; extra > 0 {
+			unexpected += extra
+			r.logger.Warn().Str("method", method).Int("count", extra).Msg("Unexpected request")
+		}
+	}
+
+	event := r.logger.Info()
+	if mismatched+missing+unexpected > 0 {
+		event = r.logger.Warn()
+	}
+	event.Int("requests", requests).Int("matched", matched).Int("mismatched", mismatched).
+		Int("missing", missing).Int("unexpected", unexpected).Msg("Replay summary")
+}
+
+// responseKey returns a key for a response from the server.
+// Responses have the IDs of the replayed requests.
+// Returns the empty string if there is no ID.
+func responseKey(id json.RawMessage) string {
+	if id == nil {
+		return ""
+	}
+	return "response:" + string(id)
+}
+
+// requestKey returns a key for the numbered occurrence of a request method from the server.
+// Server requests are keyed by method and order as the server chooses the IDs.
+func requestKey(method string, occurrence int) string {
+	return "request:" + method + "#" + strconv.Itoa(occurrence)
+}
+
+// sameResponse compares two responses, ignoring the ID and JSON RPC version.
+func sameResponse(expected, actual json.RawMessage) (bool, error) {
+	var expData, actData map[string]any
+	if err := json.Unmarshal(expected, &expData); err != nil {
+		return false, fmt.Errorf("unmarshal expected: %w", err)
+	}
+	if err := json.Unmarshal(actual, &actData); err != nil {
+		return false, fmt.Errorf("unmarshal actual: %w", err)
+	}
+	for _, field := range []string{"id", "jsonrpc"} {
+		delete(expData, field)
+		delete(actData, field)
+	}
+	return reflect.DeepEqual(expData, actData), nil
+}
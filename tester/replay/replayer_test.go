@@ -0,0 +1,164 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+const testSession = `
+{"from":"client","to":"server","msg":{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}}
+{"from":"server","to":"client","msg":{"jsonrpc":"2.0","id":1,"result":{"capabilities":{}}}}
+{"from":"server","to":"client","msg":{"jsonrpc":"2.0","id":7,"method":"workspace/configuration","params":{}}}
+{"from":"server","to":"client","msg":{"jsonrpc":"2.0","id":8,"method":"client/registerCapability","params":{}}}
+{"from":"server","to":"client","msg":{"jsonrpc":"2.0","id":9,"method":"workspace/configuration","params":{}}}
+{"from":"client","to":"server","msg":{"jsonrpc":"2.0","id":9,"result":["second"]}}
+{"from":"client","to":"server","msg":{"jsonrpc":"2.0","id":7,"result":["first"]}}
+{"from":"client","to":"server","msg":{"jsonrpc":"2.0","id":8,"result":null}}
+`
+
+func newTestReplayer(t *testing.T) *Replayer {
+	path := filepath.Join(t.TempDir(), "session.json")
+	require.NoError(t, os.WriteFile(path, []byte(testSession), 0o600))
+	set := flags.NewSet()
+	require.NoError(t, set.Parse([]string{"-replay", path}))
+	replayer, err := NewReplayer(set, nil, nil)
+	require.NoError(t, err)
+	return replayer
+}
+
+func TestReplayer_LiveResponse(t *testing.T) {
+	replayer := newTestReplayer(t)
+	// The live server numbers its requests differently than the recorded server.
+	for _, content := range []string{
+		`{"jsonrpc":"2.0","id":1,"result":{"capabilities":{}}}`,
+		`{"jsonrpc":"2.0","id":"a","method":"workspace/configuration","params":{}}`,
+		`{"jsonrpc":"2.0","id":"b","method":"workspace/configuration","params":{}}`,
+	} {
+		replayer.Observe(&message.Entry{From: "server", To: "tester", Content: []byte(content)})
+	}
+	responses := make([]*Step, 0)
+	for _, step := range replayer.steps {
+		if step.ToServer && step.IsResponse() {
+			responses = append(responses, step)
+		}
+	}
+	require.Len(t, responses, 3)
+	for i, test := range []struct {
+		name     string
+		expected string
+	}{
+		{name: "second configuration", expected: `{"jsonrpc":"2.0","id":"b","result":["second"]}`},
+		{name: "first configuration", expected: `{"jsonrpc":"2.0","id":"a","result":["first"]}`},
+		{name: "no live request", expected: ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			content, found := replayer.liveResponse(responses[i])
+			assert.Equal(t, test.expected != "", found)
+			if found {
+				assert.JSONEq(t, test.expected, string(content))
+			}
+		})
+	}
+	assert.Zero(t, replayer.missing([]string{responseKey([]byte("1")),
+		requestKey("workspace/configuration", 1), requestKey("workspace/configuration", 2)}))
+	assert.Equal(t, 1, replayer.missing([]string{requestKey("client/registerCapability", 1)}))
+}
+
+func TestLoadSession(t *testing.T) {
+	replayer := newTestReplayer(t)
+	require.Len(t, replayer.steps, 8)
+	for _, test := range []struct {
+		step     int
+		toServer bool
+		request  bool
+		response bool
+	}{
+		{step: 0, toServer: true, request: true},
+		{step: 1, response: true},
+		{step: 2, request: true},
+		{step: 5, toServer: true, response: true},
+	} {
+		step := replayer.steps[test.step]
+		assert.Equal(t, test.toServer, step.ToServer, "step %d", test.step)
+		assert.Equal(t, test.request, step.IsRequest(), "step %d", test.step)
+		assert.Equal(t, test.response, step.IsResponse(), "step %d", test.step)
+	}
+}
+
+func TestLoadSession_Clients(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		session string
+		err     bool
+	}{
+		{name: "client mode", session: `
+{"from":"tester","to":"server","msg":{"id":1,"method":"initialize","params":{}}}
+{"from":"server","to":"tester","msg":{"id":1,"result":{}}}`},
+		{name: "one Nexus client", session: `
+{"!":"server<--client-1","msg":{"id":1,"method":"initialize","params":{}}}
+{"!":"server-->client-1","msg":{"id":1,"result":{}}}`},
+		{name: "several Nexus clients", err: true, session: `
+{"!":"server<--client-1","msg":{"id":1,"method":"initialize","params":{}}}
+{"!":"server<--client-2","msg":{"id":1,"method":"initialize","params":{}}}
+{"!":"server-->client-1","msg":{"id":1,"result":{}}}
+{"!":"server-->client-2","msg":{"id":1,"result":{}}}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.json")
+			require.NoError(t, os.WriteFile(path, []byte(test.session), 0o600))
+			steps, err := LoadSession(path)
+			if test.err {
+				assert.ErrorContains(t, err, "client-1, client-2")
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, steps, 2)
+		})
+	}
+}
+
+func TestReplayer_Unexpected(t *testing.T) {
+	replayer := newTestReplayer(t)
+	var buffer bytes.Buffer
+	logger := zerolog.New(&buffer)
+	replayer.logger = &logger
+	for _, content := range []string{
+		`{"jsonrpc":"2.0","id":1,"result":{"capabilities":{}}}`,
+		`{"jsonrpc":"2.0","id":"a","method":"workspace/configuration","params":{}}`,
+		`{"jsonrpc":"2.0","id":"b","method":"workspace/configuration","params":{}}`,
+		`{"jsonrpc":"2.0","id":"c","method":"workspace/configuration","params":{}}`,
+		`{"jsonrpc":"2.0","method":"window/logMessage","params":{}}`,
+	} {
+		replayer.Observe(&message.Entry{From: "server", To: "tester", Content: []byte(content)})
+	}
+	replayer.summarize()
+	logged := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var event struct {
+			Method     string `json:"method"`
+			Message    string `json:"message"`
+			Unexpected int    `json:"unexpected"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		if event.Method != "" {
+			logged[event.Method] = event.Message
+		} else if event.Message == "Replay summary" {
+			assert.Equal(t, 2, event.Unexpected)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"workspace/configuration": "Unexpected request",
+		"window/logMessage":       "Unexpected notification",
+	}, logged)
+}
@@ -0,0 +1,126 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+// Step is a single message from a recorded session.
+type Step struct {
+	Time     time.Time
+	ToServer bool
+	Content  json.RawMessage
+	ID       json.RawMessage
+	Method   string
+}
+
+// IsRequest returns true if the step is a request (has both a method and an ID).
+func (s *Step) IsRequest() bool {
+	return s.Method != "" && s.ID != nil
+}
+
+// IsResponse returns true if the step is a response (has an ID but no method).
+func (s *Step) IsResponse() bool {
+	return s.Method == "" && s.ID != nil
+}
+
+// line holds the fields of interest from either a message.Record
+// or a log statement generated with the json log format.
+type line struct {
+	Time      time.Time       `json:"time"`
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Direction string          `json:"!"`
+	Msg       json.RawMessage `json:"msg"`
+}
+
+// message fields of interest for matching requests and responses.
+type fields struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+const (
+	leftArrow  = "<--"
+	rightArrow = "-->"
+)
+
+// LoadSession loads a recorded session from the specified path.
+// The file may be a capture file generated with the -record flag or
+// a log file generated with the json log format.
+// Only messages sent to or received from the LSP server are returned.
+// Sessions with more than one client (e.g. from Nexus mode) are rejected
+// as the clients' request IDs may collide when replayed over a single connection.
+func LoadSession(path string) ([]*Step, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open session file %s: %w", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	steps := make([]*Step, 0, 64)
+	clients := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 65536), 16*1048576)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var ln line
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		} else if err := json.Unmarshal(scanner.Bytes(), &ln); err != nil {
+			return nil, fmt.Errorf("unmarshal line %d: %w", lineNum, err)
+		} else if ln.Msg == nil {
+			// Not a message.
+			continue
+		}
+		if ln.Direction != "" {
+			// Log statement direction field is one of "to<--from" or "from-->to".
+			if parts := strings.SplitN(ln.Direction, leftArrow, 2); len(parts) == 2 {
+				ln.To, ln.From = parts[0], parts[1]
+			} else if parts = strings.SplitN(ln.Direction, rightArrow, 2); len(parts) == 2 {
+				ln.From, ln.To = parts[0], parts[1]
+			}
+		}
+		step := &Step{
+			Time:    ln.Time,
+			Content: ln.Msg,
+		}
+		if message.Direction(ln.To) == message.ToServer {
+			step.ToServer = true
+			clients[ln.From] = true
+		} else if ln.From != "server" {
+			// Not to or from the server.
+			continue
+		} else {
+			clients[ln.To] = true
+		}
+		var flds fields
+		if err := json.Unmarshal(ln.Msg, &flds); err != nil {
+			return nil, fmt.Errorf("unmarshal message on line %d: %w", lineNum, err)
+		}
+		if string(flds.ID) != "null" {
+			step.ID = flds.ID
+		}
+		step.Method = flds.Method
+		steps = append(steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan session file %s: %w", path, err)
+	}
+	if len(clients) > 1 {
+		names := make([]string, 0, len(clients))
+		for name := range clients {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("session file %s has more than one client (%s), only single client sessions can be replayed",
+			path, strings.Join(names, ", "))
+	}
+	return steps, nil
+}
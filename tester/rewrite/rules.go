@@ -0,0 +1,225 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/mock"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+var _ lsp.Rewriter = (*Rules)(nil)
+
+// Rules changes or drops messages passing between client and server in Nexus mode.
+// Rules are loaded from a JSON file of the form:
+//
+//	{
+//	  "rules": [
+//	    { "method": "textDocument/didOpen", "direction": "toServer",
+//	      "match": { "params": { "textDocument": { "languageId": "plaintext" } } },
+//	      "set": { "params.textDocument.languageId": "markdown" } },
+//	    { "method": "initialize", "direction": "toClient",
+//	      "set": { "result.capabilities.hoverProvider": true } },
+//	    { "method": "textDocument/definition", "rename": { "params.textDocument.url": "params.textDocument.uri" } },
+//	    { "method": "textDocument/hover", "direction": "toClient", "result": { "contents": "No hover for you" } },
+//	    { "method": "$/progress", "drop": true },
+//	    { "delete": [ "params.trace" ] }
+//	  ]
+//	}
+//
+// Every rule that matches a message is applied in order.
+// A rule matches if the method and direction (toServer or toClient) are the same,
+// and if every field in the match object is present with the same value in the message.
+// Empty rule fields are not used.
+// The method of a response is the method of the matching request.
+//
+// Dot-separated paths are used to rename, delete, and set fields (in that order).
+// Array elements are specified by index (e.g. "params.contentChanges.0.text").
+// A result replaces the entire result of a response.
+// A dropped message is not forwarded and no further rules are applied.
+type Rules struct {
+	logger    *zerolog.Logger
+	rules     []*rule
+	methods   map[string]*request
+	nextSweep time.Time
+	lock      sync.Mutex
+}
+
+// Keep request methods for this long while waiting for the response.
+const idExpiration = time.Minute
+
+// request is the method of a request waiting for a response.
+type request struct {
+	method  string
+	expires time.Time
+}
+
+type rule struct {
+	Method    string            `json:"method"`
+	Direction string            `json:"direction"`
+	Match     any               `json:"match"`
+	Rename    map[string]string `json:"rename"`
+	Delete    []string          `json:"delete"`
+	Set       map[string]any    `json:"set"`
+	Result    json.RawMessage   `json:"result"`
+	Drop      bool              `json:"drop"`
+	result    any
+}
+
+type rulesFile struct {
+	Rules []*rule `json:"rules"`
+}
+
+// LoadRules loads the rules file at the specified path.
+func LoadRules(path string) (*Rules, error) {
+	var file rulesFile
+	if content, err := os.ReadFile(path); err != nil {
+		return nil, fmt.Errorf("read rewrite file %s: %w", path, err)
+	} else if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("unmarshal rewrite file %s: %w", path, err)
+	}
+
+	for i, rule := range file.Rules {
+		switch rule.Direction {
+		case "", message.ToServer, message.ToClient:
+		default:
+			return nil, fmt.Errorf("rule %d has unknown direction '%s'", i, rule.Direction)
+		}
+		if rule.Result != nil {
+			if err := json.Unmarshal(rule.Result, &rule.result); err != nil {
+				return nil, fmt.Errorf("unmarshal result for rule %d: %w", i, err)
+			}
+		}
+	}
+	logger := log.With().Str("svc", "rewrite").Logger()
+	return &Rules{
+		logger:  &logger,
+		rules:   file.Rules,
+		methods: make(map[string]*request),
+	}, nil
+}
+
+// Rewrite applies all matching rules to content forwarded between the named Receivers.
+func (r *Rules) Rewrite(from, to string, content []byte) ([]byte, bool) {
+	msg := make(data.AnyMap)
+	if err := json.Unmarshal(content, &msg); err != nil {
+		r.logger.Warn().Err(err).Msg("Unmarshal content")
+		return content, true
+	}
+
+	direction, client := message.ToServer, from
+	if from == "server" {
+		direction, client = message.ToClient, to
+	}
+	method := r.method(client, direction, msg)
+	changed := false
+	for i, rule := range r.rules {
+		if !rule.matches(direction, method, msg) {
+			continue
+		}
+		if rule.Drop {
+			r.logger.Debug().Int("rule", i).Str("method", method).Msg("Drop")
+			return nil, false
+		}
+		r.logger.Debug().Int("rule", i).Str("method", method).Msg("Rewrite")
+		rule.apply(msg, r.logger)
+		changed = true
+	}
+	if !changed {
+		return content, true
+	}
+	if rewritten, err := json.Marshal(msg); err != nil {
+		r.logger.Warn().Err(err).Msg("Marshal rewritten content")
+		return content, true
+	} else {
+		return rewritten, true
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// method returns the method of the message.
+// Request methods are kept by client connection, direction, and ID
+// so that the method of the response can be found.
+// Requests without a response are forgotten after idExpiration.
+func (r *Rules) method(client, direction string, msg data.AnyMap) string {
+	id, hasID := msg.GetField("id")
+	if !hasID {
+		method, _ := msg.GetStringField("method")
+		return method
+	}
+	idJSON, _ := json.Marshal(id)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	if method, found := msg.GetStringField("method"); found {
+		r.expire(now)
+		r.methods[client+" "+direction+" "+string(idJSON)] = &request{method: method, expires: now.Add(idExpiration)}
+		return method
+	}
+	// The response goes in the opposite direction from the request.
+	requestDirection := message.ToServer
+	if direction == message.ToServer {
+		requestDirection = message.ToClient
+	}
+	key := client + " " + requestDirection + " " + string(idJSON)
+	rqst, found := r.methods[key]
+	if !found {
+		return ""
+	}
+	delete(r.methods, key)
+	return rqst.method
+}
+
+// expire deletes expired requests, checking at most once per idExpiration.
+func (r *Rules) expire(now time.Time) {
+	if now.Before(r.nextSweep) {
+		return
+	}
+	r.nextSweep = now.Add(idExpiration)
+	for key, rqst := range r.methods {
+		if now.After(rqst.expires) {
+			delete(r.methods, key)
+		}
+	}
+}
+
+func (rl *rule) matches(direction, method string, msg data.AnyMap) bool {
+	if rl.Direction != "" && rl.Direction != direction {
+		return false
+	}
+	if rl.Method != "" && rl.Method != method {
+		return false
+	}
+	return mock.Matches(rl.Match, map[string]any(msg))
+}
+
+func (rl *rule) apply(msg data.AnyMap, logger *zerolog.Logger) {
+	for from, to := range rl.Rename {
+		if value, found := msg.GetPath(from); found {
+			msg.DeletePath(from)
+			if err := msg.SetPath(to, value); err != nil {
+				logger.Warn().Err(err).Str("from", from).Str("to", to).Msg("Rename field")
+			}
+		}
+	}
+	for _, path := range rl.Delete {
+		msg.DeletePath(path)
+	}
+	for path, value := range rl.Set {
+		if err := msg.SetPath(path, value); err != nil {
+			logger.Warn().Err(err).Str("path", path).Msg("Set field")
+		}
+	}
+	if rl.Result != nil && msg.HasField("result") {
+		msg["result"] = rl.result
+	}
+}
@@ -0,0 +1,119 @@
+package rewrite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `{
+  "rules": [
+    { "method": "textDocument/didOpen", "direction": "toServer",
+      "match": { "params": { "textDocument": { "languageId": "plaintext" } } },
+      "set": { "params.textDocument.languageId": "markdown" } },
+    { "method": "textDocument/definition", "rename": { "params.textDocument.url": "params.textDocument.uri" } },
+    { "method": "textDocument/hover", "direction": "toClient", "result": { "contents": "No hover for you" } },
+    { "method": "$/progress", "drop": true },
+    { "delete": [ "params.trace" ] }
+  ]
+}`
+
+func loadTestRules(t *testing.T, content string) *Rules {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	return rules
+}
+
+func TestRules_Rewrite(t *testing.T) {
+	rules := loadTestRules(t, testRules)
+	for _, test := range []struct {
+		name     string
+		from, to string
+		content  string
+		expected string
+		dropped  bool
+	}{
+		{
+			name: "set", from: "client-1", to: "server",
+			content:  `{"method":"textDocument/didOpen","params":{"textDocument":{"languageId":"plaintext"}}}`,
+			expected: `{"method":"textDocument/didOpen","params":{"textDocument":{"languageId":"markdown"}}}`,
+		},
+		{
+			name: "no match", from: "client-1", to: "server",
+			content:  `{"method":"textDocument/didOpen","params":{"textDocument":{"languageId":"go"}}}`,
+			expected: `{"method":"textDocument/didOpen","params":{"textDocument":{"languageId":"go"}}}`,
+		},
+		{
+			name: "rename", from: "client-1", to: "server",
+			content:  `{"id":3,"method":"textDocument/definition","params":{"textDocument":{"url":"file:///a.go"}}}`,
+			expected: `{"id":3,"method":"textDocument/definition","params":{"textDocument":{"uri":"file:///a.go"}}}`,
+		},
+		{
+			name: "drop", from: "server", to: "client-1",
+			content: `{"method":"$/progress","params":{}}`,
+			dropped: true,
+		},
+		{
+			name: "delete any method", from: "server", to: "client-1",
+			content:  `{"method":"window/logMessage","params":{"message":"x","trace":true}}`,
+			expected: `{"method":"window/logMessage","params":{"message":"x"}}`,
+		},
+		{
+			name: "wrong direction", from: "server", to: "client-1",
+			content:  `{"method":"textDocument/didOpen","params":{"textDocument":{"languageId":"plaintext"}}}`,
+			expected: `{"method":"textDocument/didOpen","params":{"textDocument":{"languageId":"plaintext"}}}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rewritten, keep := rules.Rewrite(test.from, test.to, []byte(test.content))
+			assert.Equal(t, !test.dropped, keep)
+			if !test.dropped {
+				assert.JSONEq(t, test.expected, string(rewritten))
+			}
+		})
+	}
+}
+
+func TestRules_ResponseMethod(t *testing.T) {
+	rules := loadTestRules(t, testRules)
+	// Two clients use the same request ID for different methods.
+	_, _ = rules.Rewrite("client-1", "server", []byte(`{"id":1,"method":"textDocument/hover","params":{}}`))
+	_, _ = rules.Rewrite("client-2", "server", []byte(`{"id":1,"method":"textDocument/completion","params":{}}`))
+	for _, test := range []struct {
+		name     string
+		to       string
+		expected string
+	}{
+		{name: "completion", to: "client-2", expected: `{"id":1,"result":null}`},
+		{name: "hover", to: "client-1", expected: `{"id":1,"result":{"contents":"No hover for you"}}`},
+		{name: "no request", to: "client-1", expected: `{"id":1,"result":null}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rewritten, keep := rules.Rewrite("server", test.to, []byte(`{"id":1,"result":null}`))
+			assert.True(t, keep)
+			assert.JSONEq(t, test.expected, string(rewritten))
+		})
+	}
+}
+
+func TestRules_Expire(t *testing.T) {
+	rules := loadTestRules(t, testRules)
+	_, _ = rules.Rewrite("client-1", "server", []byte(`{"id":1,"method":"textDocument/hover","params":{}}`))
+	_, _ = rules.Rewrite("client-1", "server", []byte(`{"id":2,"method":"textDocument/hover","params":{}}`))
+	assert.Len(t, rules.methods, 2)
+	rules.expire(time.Now().Add(2 * idExpiration))
+	assert.Empty(t, rules.methods)
+}
+
+func TestLoadRules_BadDirection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"direction":"sideways"}]}`), 0o600))
+	_, err := LoadRules(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,252 @@
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/madkins23/go-utils/app"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+var (
+	_ message.Observer = (*Runner)(nil)
+	_ app.SubSystem    = (*Runner)(nil)
+)
+
+// errShutdown is returned by a step interrupted by application shutdown.
+var errShutdown = errors.New("shut down before scenario finished")
+
+// Runner executes a Scenario against an LSP server.
+// The Runner should be added to the app.Terminator so that a scenario
+// interrupted by shutdown (e.g. when the server exits) fails immediately.
+type Runner struct {
+	flags      *flags.Set
+	logger     *zerolog.Logger
+	msgLgr     *message.Logger
+	terminator *app.Terminator
+	scenario   *Scenario
+	received   []data.AnyMap
+	arrived    chan bool
+	lastID     any
+	lastMsg    data.AnyMap
+	passed     atomic.Bool
+	stop       chan struct{}
+	stopOnce   sync.Once
+	lock       sync.Mutex
+}
+
+func NewRunner(flags *flags.Set, msgLgr *message.Logger, terminator *app.Terminator) (*Runner, error) {
+	scenario, err := LoadScenario(flags.ScenarioPath())
+	if err != nil {
+		return nil, fmt.Errorf("load scenario: %w", err)
+	}
+	logger := log.With().Str("svc", "scenario").Logger()
+	return &Runner{
+		flags:      flags,
+		logger:     &logger,
+		msgLgr:     msgLgr,
+		terminator: terminator,
+		scenario:   scenario,
+		received:   make([]data.AnyMap, 0),
+		arrived:    make(chan bool, 1),
+		stop:       make(chan struct{}),
+	}, nil
+}
+
+// Failed returns true unless every scenario step passed.
+// A scenario that has not finished or was interrupted by shutdown has failed.
+func (r *Runner) Failed() bool {
+	return !r.passed.Load()
+}
+
+// Shutdown interrupts the scenario.
+func (r *Runner) Shutdown() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	return nil
+}
+
+// Observe queues messages received from the server to be checked by wait steps.
+func (r *Runner) Observe(entry *message.Entry) {
+	if entry.From != "server" {
+		return
+	}
+	msg := make(data.AnyMap)
+	if err := json.Unmarshal(entry.Content, &msg); err != nil {
+		r.logger.Warn().Err(err).Msg("Unmarshal server message")
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.received = append(r.received, msg)
+	select {
+	case r.arrived <- true:
+	default:
+	}
+}
+
+// Run executes the scenario steps in order, stopping at the first failure.
+// When done a summary is logged and the application is shut down.
+func (r *Runner) Run(server lsp.Receiver) {
+	r.logger.Info().Int("steps", len(r.scenario.Steps)).Str("file", r.flags.ScenarioPath()).Msg("Scenario starting")
+	defer r.logger.Info().Msg("Scenario finished")
+
+	var passed int
+	for i, step := range r.scenario.Steps {
+		if err := r.execute(server, step); err != nil {
+			r.logger.Error().Err(err).Int("step", i+1).Str("kind", step.Kind()).Msg("Step failed")
+			break
+		}
+		r.logger.Debug().Int("step", i+1).Str("kind", step.Kind()).Msg("Step passed")
+		passed++
+	}
+	r.passed.Store(passed == len(r.scenario.Steps))
+
+	event := r.logger.Info()
+	if r.Failed() {
+		event = r.logger.Error()
+	}
+	event.Int("passed", passed).Int("steps", len(r.scenario.Steps)).Bool("failed", r.Failed()).Msg("Scenario summary")
+
+	if err := r.terminator.Shutdown(); err != nil {
+		r.logger.Error().Err(err).Msg("Terminating")
+	}
+}
+
+func (r *Runner) execute(server lsp.Receiver, step *Step) error {
+	select {
+	case <-r.stop:
+		return errShutdown
+	default:
+	}
+	switch {
+	case step.Send != nil:
+		if msg, err := r.loadMessage(step.Send); err != nil {
+			return fmt.Errorf("load request: %w", err)
+		} else if err := server.SendMessage(server.ConnectedTo(), msg, r.msgLgr); err != nil {
+			return fmt.Errorf("send request: %w", err)
+		} else {
+			r.lastID = msg["id"]
+		}
+	case step.Notify != nil:
+		if msg, err := r.loadMessage(step.Notify); err != nil {
+			return fmt.Errorf("load notification: %w", err)
+		} else if err := sendNotification(server, msg, r.msgLgr); err != nil {
+			return fmt.Errorf("send notification: %w", err)
+		}
+	case step.Wait != nil:
+		if msg, err := r.wait(step.Wait); err != nil {
+			return err
+		} else {
+			r.lastMsg = msg
+		}
+	case step.Assert != nil:
+		if r.lastMsg == nil {
+			return errors.New("no message for assertion")
+		} else if err := step.Assert.Check(r.lastMsg); err != nil {
+			return fmt.Errorf("assertion: %w", err)
+		}
+	case step.Sleep != "":
+		duration, _ := time.ParseDuration(step.Sleep) // Already validated.
+		select {
+		case <-time.After(duration):
+		case <-r.stop:
+			return errShutdown
+		}
+	}
+	return nil
+}
+
+// wait for a message from the server matching the Wait criteria.
+// Messages are checked in the order they were received and
+// a matching message is removed so that it will not be matched again.
+func (r *Runner) wait(wait *Wait) (data.AnyMap, error) {
+	timeout := r.scenario.timeout
+	if wait.Timeout != "" {
+		timeout, _ = time.ParseDuration(wait.Timeout) // Already validated.
+	}
+	if wait.Response && r.lastID == nil {
+		return nil, errors.New("no request sent for response")
+	}
+	deadline := time.After(timeout)
+	for {
+		if msg := r.match(wait); msg != nil {
+			return msg, nil
+		}
+		select {
+		case <-r.arrived:
+		case <-deadline:
+			return nil, fmt.Errorf("no matching message after %s", timeout)
+		case <-r.stop:
+			return nil, errShutdown
+		}
+	}
+}
+
+func (r *Runner) match(wait *Wait) data.AnyMap {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i, msg := range r.received {
+		method, hasMethod := msg.GetStringField("method")
+		if wait.Response {
+			if id, found := msg.GetField("id"); hasMethod || !found || fmt.Sprint(id) != fmt.Sprint(r.lastID) {
+				continue
+			}
+		}
+		if wait.Method != "" && method != wait.Method {
+			continue
+		}
+		if wait.Path != "" && wait.Check(msg) != nil {
+			continue
+		}
+		r.received = append(r.received[:i], r.received[i+1:]...)
+		return msg
+	}
+	return nil
+}
+
+// loadMessage loads a message from a file or an inline message object.
+// Message file paths may be relative to the -messages directory or the scenario file.
+func (r *Runner) loadMessage(raw json.RawMessage) (data.AnyMap, error) {
+	var msgPath string
+	if err := json.Unmarshal(raw, &msgPath); err != nil {
+		msg := make(data.AnyMap)
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, fmt.Errorf("unmarshal inline message: %w", err)
+		}
+		return msg, nil
+	}
+	if !filepath.IsAbs(msgPath) {
+		for _, dir := range []string{r.flags.MessageDir(), filepath.Dir(r.flags.ScenarioPath())} {
+			if dir != "" {
+				if stat, err := os.Stat(filepath.Join(dir, msgPath)); err == nil && !stat.IsDir() {
+					msgPath = filepath.Join(dir, msgPath)
+					break
+				}
+			}
+		}
+	}
+	return message.LoadMessage(msgPath)
+}
+
+// sendNotification sends a message without adding a request ID.
+func sendNotification(server lsp.Receiver, msg data.AnyMap, msgLgr *message.Logger) error {
+	msg["jsonrpc"] = "2.0"
+	if content, err := json.Marshal(msg); err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	} else {
+		return server.SendContent("tester", server.ConnectedTo(), content, msgLgr)
+	}
+}
@@ -0,0 +1,92 @@
+package scenario
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madkins23/go-utils/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+const testScenario = `{
+  "timeout": "10s",
+  "steps": [
+    { "send": { "method": "initialize", "params": {} } },
+    { "wait": { "response": true } },
+    { "send": { "method": "textDocument/hover", "params": {} } },
+    { "wait": { "response": true } },
+    { "assert": { "path": "result.contents", "equals": "hover" } }
+  ]
+}`
+
+// testServer answers a number of requests and then closes the connection.
+type testServer struct {
+	lsp.Receiver
+	runner     *Runner
+	terminator *app.Terminator
+	answer     int
+	sent       int
+	lock       sync.Mutex
+}
+
+func (ts *testServer) ConnectedTo() string {
+	return "server"
+}
+
+func (ts *testServer) SendMessage(_ string, msg data.AnyMap, _ *message.Logger) error {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.sent++
+	msg["id"] = ts.sent
+	if ts.sent > ts.answer {
+		// The Receiver shuts down the application when the server closes the connection.
+		go func() { _ = ts.terminator.Shutdown() }()
+		return nil
+	}
+	response, err := json.Marshal(map[string]any{"id": ts.sent, "result": map[string]any{"contents": "hover"}})
+	if err != nil {
+		return err
+	}
+	go ts.runner.Observe(&message.Entry{From: "server", To: "tester", Content: response})
+	return nil
+}
+
+func TestRunner_Run(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		answer int
+		failed bool
+	}{
+		{name: "passed", answer: 2},
+		{name: "server closed", answer: 1, failed: true},
+		{name: "server closed at once", answer: 0, failed: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.json")
+			require.NoError(t, os.WriteFile(path, []byte(testScenario), 0o600))
+			set := flags.NewSet()
+			require.NoError(t, set.Parse([]string{"-scenario", path}))
+			terminator := app.NewTerminator()
+			runner, err := NewRunner(set, nil, terminator)
+			require.NoError(t, err)
+			terminator.Add(runner)
+			assert.True(t, runner.Failed(), "not run yet")
+
+			start := time.Now()
+			runner.Run(&testServer{runner: runner, terminator: terminator, answer: test.answer})
+			assert.Equal(t, test.failed, runner.Failed())
+			// The scenario is interrupted instead of waiting for the timeout.
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+)
+
+// Scenario is a list of steps to be executed against an LSP server.
+// Scenarios are loaded from a JSON file of the form:
+//
+//	{
+//	  "timeout": "10s",
+//	  "steps": [
+//	    { "send": "initialize.json" },
+//	    { "wait": { "response": true } },
+//	    { "assert": { "path": "result.capabilities.hoverProvider", "equals": true } },
+//	    { "notify": { "method": "initialized", "params": {} } },
+//	    { "wait": { "method": "textDocument/publishDiagnostics", "path": "params.uri", "contains": "main.go" } },
+//	    { "sleep": "1s" }
+//	  ]
+//	}
+type Scenario struct {
+	Timeout string  `json:"timeout"`
+	Steps   []*Step `json:"steps"`
+	timeout time.Duration
+}
+
+// Step is a single action in a scenario.
+// Exactly one of the fields must be set.
+type Step struct {
+	// Send a request message, either a file name or an inline message object.
+	Send json.RawMessage `json:"send"`
+	// Notify sends a notification message, either a file name or an inline message object.
+	Notify json.RawMessage `json:"notify"`
+	// Wait for a message from the server.
+	Wait *Wait `json:"wait"`
+	// Assert a condition on the last message waited for.
+	Assert *Condition `json:"assert"`
+	// Sleep for a duration (e.g. "500ms").
+	Sleep string `json:"sleep"`
+}
+
+// Wait for a message from the server matching all specified criteria.
+type Wait struct {
+	// Response waits for the response to the last request sent.
+	Response bool `json:"response"`
+	// Method of notification or server request.
+	Method string `json:"method"`
+	// Timeout overrides the scenario timeout (e.g. "30s").
+	Timeout string `json:"timeout"`
+	// Condition which must be true for the message, if a path is specified.
+	Condition
+}
+
+// Condition on the value at a path within a message.
+type Condition struct {
+	// Path to a value in the message, for example "result.items.0.label".
+	Path string `json:"path"`
+	// Exists checks whether the path exists (or doesn't).
+	Exists *bool `json:"exists"`
+	// Equals compares the value with the specified JSON value.
+	Equals any `json:"equals"`
+	// Contains checks whether the value (or its JSON representation) contains a string.
+	Contains string `json:"contains"`
+	// Matches checks whether the value (or its JSON representation) matches a regular expression.
+	Matches string `json:"matches"`
+	// Length checks the length of an array, object, or string.
+	Length *int `json:"length"`
+}
+
+const defaultTimeout = 5 * time.Second
+
+// LoadScenario loads a scenario from the specified path.
+func LoadScenario(path string) (*Scenario, error) {
+	var scenario Scenario
+	if content, err := os.ReadFile(path); err != nil {
+		return nil, fmt.Errorf("read scenario file %s: %w", path, err)
+	} else if err := json.Unmarshal(content, &scenario); err != nil {
+		return nil, fmt.Errorf("unmarshal scenario file %s: %w", path, err)
+	}
+	scenario.timeout = defaultTimeout
+	if scenario.Timeout != "" {
+		var err error
+		if scenario.timeout, err = time.ParseDuration(scenario.Timeout); err != nil {
+			return nil, fmt.Errorf("parse scenario timeout: %w", err)
+		}
+	}
+	for i, step := range scenario.Steps {
+		if err := step.validate(); err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return &scenario, nil
+}
+
+func (s *Step) validate() error {
+	var count int
+	for _, set := range []bool{s.Send != nil, s.Notify != nil, s.Wait != nil, s.Assert != nil, s.Sleep != ""} {
+		if set {
+			count++
+		}
+	}
+	if count != 1 {
+		return errors.New("must have exactly one of send, notify, wait, assert, or sleep")
+	}
+	if s.Sleep != "" {
+		if _, err := time.ParseDuration(s.Sleep); err != nil {
+			return fmt.Errorf("parse sleep: %w", err)
+		}
+	}
+	if s.Wait != nil {
+		if s.Wait.Timeout != "" {
+			if _, err := time.ParseDuration(s.Wait.Timeout); err != nil {
+				return fmt.Errorf("parse wait timeout: %w", err)
+			}
+		}
+		if !s.Wait.Response && s.Wait.Method == "" && s.Wait.Path == "" {
+			return errors.New("wait must specify response, method, or path")
+		}
+	}
+	if s.Assert != nil && s.Assert.Path == "" {
+		return errors.New("assert must specify path")
+	}
+	return nil
+}
+
+// Kind returns the name of the kind of step.
+func (s *Step) Kind() string {
+	switch {
+	case s.Send != nil:
+		return "send"
+	case s.Notify != nil:
+		return "notify"
+	case s.Wait != nil:
+		return "wait"
+	case s.Assert != nil:
+		return "assert"
+	default:
+		return "sleep"
+	}
+}
+
+// Check returns nil if the condition is true for the specified message.
+func (c *Condition) Check(msg data.AnyMap) error {
+	value, found := msg.GetPath(c.Path)
+	if c.Exists != nil {
+		if found != *c.Exists {
+			return fmt.Errorf("%s exists is %t", c.Path, found)
+		}
+	} else if !found {
+		return fmt.Errorf("%s not found", c.Path)
+	}
+	if c.Equals != nil && !reflect.DeepEqual(c.Equals, value) {
+		return fmt.Errorf("%s is %s not %s", c.Path, toString(value), toString(c.Equals))
+	}
+	if c.Contains != "" && !strings.Contains(toString(value), c.Contains) {
+		return fmt.Errorf("%s value %s does not contain '%s'", c.Path, toString(value), c.Contains)
+	}
+	if c.Matches != "" {
+		if re, err := regexp.Compile(c.Matches); err != nil {
+			return fmt.Errorf("compile matches expression: %w", err)
+		} else if !re.MatchString(toString(value)) {
+			return fmt.Errorf("%s value %s does not match '%s'", c.Path, toString(value), c.Matches)
+		}
+	}
+	if c.Length != nil {
+		var length int
+		switch item := value.(type) {
+		case string:
+			length = len(item)
+		case []any:
+			length = len(item)
+		case map[string]any:
+			length = len(item)
+		default:
+			return fmt.Errorf("%s has no length", c.Path)
+		}
+		if length != *c.Length {
+			return fmt.Errorf("%s length is %d not %d", c.Path, length, *c.Length)
+		}
+	}
+	return nil
+}
+
+// toString returns a string value as is and anything else as JSON.
+func toString(value any) string {
+	if str, ok := value.(string); ok {
+		return str
+	} else if jsonBytes, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%v", value)
+	} else {
+		return string(jsonBytes)
+	}
+}
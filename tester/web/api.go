@@ -0,0 +1,245 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/madkins23/lsp-tester/tester/fault"
+	"github.com/madkins23/lsp-tester/tester/logging"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+// apiPrefix is the URL prefix for all JSON API calls.
+// The version will be changed if the API changes incompatibly.
+const apiPrefix = "/api/v1/"
+
+// handleAPI configures the JSON API handlers.
+func (s *Server) handleAPI() {
+	s.stats = NewStats()
+	s.msgLgr.AddObserver(s.stats)
+	http.HandleFunc(apiPrefix+"receivers", s.apiMethods(s.apiReceivers, "GET"))
+	http.HandleFunc(apiPrefix+"send", s.apiMethods(s.apiSend, "POST"))
+	http.HandleFunc(apiPrefix+"formats", s.apiMethods(s.apiFormats, "GET", "PUT"))
+	http.HandleFunc(apiPrefix+"messages", s.apiMethods(s.apiMessages, "GET"))
+	http.HandleFunc(apiPrefix+"shutdown", s.apiMethods(s.apiShutdown, "POST"))
+	http.HandleFunc(apiPrefix+"stats", s.apiMethods(s.apiStats, "GET"))
+	http.HandleFunc(apiPrefix+"faults", s.apiMethods(s.apiFaults, "GET", "PUT"))
+}
+
+// apiError is returned as the JSON body of failed API calls.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiResult is returned as the JSON body of API calls that have no other result.
+type apiResult struct {
+	Result string `json:"result"`
+}
+
+// apiMethods wraps an API handler so that it is only called for the specified HTTP methods.
+func (s *Server) apiMethods(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, rqst *http.Request) {
+		for _, method := range methods {
+			if rqst.Method == method {
+				handler(w, rqst)
+				return
+			}
+		}
+		s.apiFail(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", rqst.Method))
+	}
+}
+
+func (s *Server) apiRespond(w http.ResponseWriter, status int, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(result); err != nil {
+		s.logger.Error().Err(err).Msg("Write API response")
+	}
+}
+
+func (s *Server) apiFail(w http.ResponseWriter, status int, err error) {
+	s.apiRespond(w, status, &apiError{Error: err.Error()})
+}
+
+func (s *Server) apiReceivers(w http.ResponseWriter, _ *http.Request) {
+	names := make([]string, 0, len(lsp.Receivers()))
+	for name := range lsp.Receivers() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s.apiRespond(w, http.StatusOK, names)
+}
+
+// apiSendRequest is the JSON body for the send call.
+// The KeepID and Raw fields work as for the compose form on the main page.
+type apiSendRequest struct {
+	Target  string          `json:"target"`
+	Message json.RawMessage `json:"message"`
+	KeepID  bool            `json:"keepID"`
+	Raw     bool            `json:"raw"`
+}
+
+func (s *Server) apiSend(w http.ResponseWriter, rqst *http.Request) {
+	var send apiSendRequest
+	if err := json.NewDecoder(rqst.Body).Decode(&send); err != nil {
+		s.apiFail(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+	} else if err := s.sendComposed(send.Target, send.Message, send.KeepID, send.Raw); err != nil {
+		s.apiFail(w, http.StatusBadRequest, err)
+	} else {
+		s.apiRespond(w, http.StatusOK, &apiResult{Result: "Message sent"})
+	}
+}
+
+// apiFormats is the JSON body for getting and setting log formats.
+// When setting formats empty fields are not changed.
+type apiFormats struct {
+	Console string   `json:"console,omitempty"`
+	File    string   `json:"file,omitempty"`
+	All     []string `json:"all,omitempty"`
+}
+
+func (s *Server) apiFormats(w http.ResponseWriter, rqst *http.Request) {
+	if rqst.Method == "PUT" {
+		var formats apiFormats
+		if err := json.NewDecoder(rqst.Body).Decode(&formats); err != nil {
+			s.apiFail(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+			return
+		}
+		for _, format := range []string{formats.Console, formats.File} {
+			if format != "" && !logging.IsFormat(format) {
+				s.apiFail(w, http.StatusBadRequest, fmt.Errorf("unknown log format '%s'", format))
+				return
+			}
+		}
+		if formats.File != "" && !s.logMgr.HasLogFile() {
+			s.apiFail(w, http.StatusBadRequest, fmt.Errorf("no log file configured"))
+			return
+		}
+		if formats.Console != "" {
+			s.logMgr.SetStdFormat(formats.Console)
+		}
+		if formats.File != "" {
+			s.logMgr.SetFileFormat(formats.File)
+		}
+	}
+	formats := &apiFormats{
+		Console: s.logMgr.StdFormat(),
+		All:     logging.AllFormats(),
+	}
+	if s.logMgr.HasLogFile() {
+		formats.File = s.logMgr.FileFormat()
+	}
+	s.apiRespond(w, http.StatusOK, formats)
+}
+
+func (s *Server) apiMessages(w http.ResponseWriter, _ *http.Request) {
+	messages := s.messages.List()
+	if messages == nil {
+		messages = []string{}
+	}
+	s.apiRespond(w, http.StatusOK, messages)
+}
+
+func (s *Server) apiShutdown(w http.ResponseWriter, _ *http.Request) {
+	s.apiRespond(w, http.StatusOK, &apiResult{Result: "Shutting down"})
+	s.logger.Info().Msg("Exit")
+	s.exit()
+}
+
+func (s *Server) apiStats(w http.ResponseWriter, _ *http.Request) {
+	snapshot := s.stats.Snapshot()
+	snapshot.Latency = s.msgLgr.Latency().Summary()
+	s.apiRespond(w, http.StatusOK, snapshot)
+}
+
+// apiFaults gets or sets the fault injection settings.
+// Settings are replaced entirely so any fields not specified are turned off.
+func (s *Server) apiFaults(w http.ResponseWriter, rqst *http.Request) {
+	if s.faults == nil {
+		s.apiFail(w, http.StatusNotFound, errors.New("fault injection only available in Nexus mode"))
+		return
+	}
+	if rqst.Method == "PUT" {
+		var settings fault.Settings
+		if err := json.NewDecoder(rqst.Body).Decode(&settings); err != nil {
+			s.apiFail(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+			return
+		} else if err := s.faults.SetSettings(settings); err != nil {
+			s.apiFail(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	s.apiRespond(w, http.StatusOK, s.faults.Settings())
+}
+
+//-----------------------------------------------------------------------------
+
+var _ message.Observer = (*Stats)(nil)
+
+// Stats counts messages passing through the message.Logger.
+type Stats struct {
+	started  time.Time
+	messages map[string]uint64
+	types    map[string]uint64
+	bytes    uint64
+	lock     sync.Mutex
+}
+
+// StatsSnapshot is the JSON version of the Stats at a point in time.
+type StatsSnapshot struct {
+	Started  time.Time         `json:"started"`
+	Uptime   string            `json:"uptime"`
+	Messages uint64            `json:"messages"`
+	Bytes    uint64            `json:"bytes"`
+	ByDir    map[string]uint64 `json:"byDirection"`
+	ByType   map[string]uint64 `json:"byType"`
+	// Latency durations are in nanoseconds.
+	Latency []*message.LatencySummary `json:"latency"`
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		started:  time.Now(),
+		messages: make(map[string]uint64),
+		types:    make(map[string]uint64),
+	}
+}
+
+// Observe counts a message.
+func (st *Stats) Observe(entry *message.Entry) {
+	fields := entry.Fields()
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.messages[entry.Direction()]++
+	st.types[fields.Type]++
+	st.bytes += uint64(len(entry.Content))
+}
+
+// Snapshot returns a copy of the current statistics.
+func (st *Stats) Snapshot() *StatsSnapshot {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	snapshot := &StatsSnapshot{
+		Started: st.started,
+		Uptime:  time.Since(st.started).Round(time.Second).String(),
+		Bytes:   st.bytes,
+		ByDir:   make(map[string]uint64, len(st.messages)),
+		ByType:  make(map[string]uint64, len(st.types)),
+	}
+	for dir, count := range st.messages {
+		snapshot.ByDir[dir] = count
+		snapshot.Messages += count
+	}
+	for typ, count := range st.types {
+		snapshot.ByType[typ] = count
+	}
+	return snapshot
+}
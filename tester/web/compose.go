@@ -0,0 +1,104 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+// preComposeLoad fills the compose form with the content of a message file
+// specified by the edit query value or a history item specified by the seq query value.
+func (s *Server) preComposeLoad(rqst *http.Request, anyData data.AnyMap) {
+	var content []byte
+	if name := rqst.FormValue("edit"); name != "" {
+		msgPath, err := s.messages.Path(name)
+		if err == nil {
+			content, err = os.ReadFile(msgPath)
+		}
+		if err != nil {
+			anyData["errors"] = []string{fmt.Sprintf("Load message file %s: %s", name, err)}
+			return
+		}
+		lastMessage = name
+		anyData["lastMessage"] = lastMessage
+	} else if s.history == nil {
+		anyData["errors"] = []string{"Message history not enabled (-history=0)"}
+		return
+	} else if item, err := s.historySelected(rqst); err != nil {
+		anyData["errors"] = []string{err.Error()}
+		return
+	} else if item == nil {
+		return
+	} else {
+		content = item.Content
+		// Assume that a message from history is to be sent with its original ID.
+		anyData["keepID"] = true
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, content, "", "  "); err != nil {
+		anyData["compose"] = string(content)
+	} else {
+		anyData["compose"] = pretty.String()
+	}
+}
+
+// preComposePost sends the message content from the compose form.
+// Unless the raw option is set the content must be a JSON object
+// which is sent via SendMessage (or SendMessageWithID if the keepID option is set).
+func (s *Server) preComposePost(rqst *http.Request, anyData data.AnyMap) {
+	content := strings.TrimSpace(rqst.FormValue("content"))
+	keepID := rqst.FormValue("keepID") != ""
+	raw := rqst.FormValue("raw") != ""
+	anyData["compose"] = content
+	anyData["keepID"] = keepID
+	anyData["raw"] = raw
+	tgt := rqst.FormValue("target")
+	if tgt != "" {
+		lastTarget = tgt
+		anyData["lastTarget"] = lastTarget
+	}
+	if err := s.sendComposed(tgt, []byte(content), keepID, raw); err != nil {
+		anyData["errors"] = []string{err.Error()}
+	} else {
+		anyData["result"] = []string{"Message sent"}
+	}
+}
+
+func (s *Server) sendComposed(tgt string, content []byte, keepID, raw bool) error {
+	var rcvr lsp.Receiver
+	if tgt == "" {
+		return errors.New("no target specified")
+	} else if rcvr = lsp.GetReceiver(tgt); rcvr == nil {
+		return fmt.Errorf("no such receiver '%s'", tgt)
+	} else if len(content) == 0 {
+		return errors.New("no message specified")
+	}
+	if raw {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, content); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		} else if err := rcvr.SendContent("tester", tgt, compact.Bytes(), s.msgLgr); err != nil {
+			return fmt.Errorf("send message to %s: %w", tgt, err)
+		}
+		return nil
+	}
+	msg := make(data.AnyMap)
+	if err := json.Unmarshal(content, &msg); err != nil {
+		return fmt.Errorf("invalid JSON message: %w", err)
+	}
+	send := rcvr.SendMessage
+	if keepID {
+		send = rcvr.SendMessageWithID
+	}
+	if err := send(tgt, msg, s.msgLgr); err != nil {
+		return fmt.Errorf("send message to %s: %w", tgt, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/fault"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+func (s *Server) preFaults(rqst *http.Request, anyData data.AnyMap) {
+	if s.faults == nil {
+		anyData["errors"] = []string{"Fault injection only available in Nexus mode"}
+		return
+	}
+	if rqst.Method == "POST" {
+		var result string
+		var err error
+		switch rqst.FormValue("form") {
+		case "settings":
+			result, err = s.preFaultsSettings(rqst)
+		case "close":
+			result, err = preFaultsClose(rqst)
+		default:
+			err = fmt.Errorf("unknown form '%s'", rqst.FormValue("form"))
+		}
+		if err != nil {
+			anyData["errors"] = []string{err.Error()}
+		} else {
+			anyData["result"] = []string{result}
+		}
+	}
+	anyData["settings"] = s.faults.Settings()
+}
+
+func (s *Server) preFaultsSettings(rqst *http.Request) (string, error) {
+	settings := fault.Settings{
+		Enabled: rqst.FormValue("enabled") != "",
+		Delay:   rqst.FormValue("delay"),
+	}
+	var err error
+	for _, field := range []struct {
+		name  string
+		value *float64
+	}{
+		{"drop", &settings.Drop},
+		{"corrupt", &settings.Corrupt},
+		{"close", &settings.Close},
+	} {
+		if str := rqst.FormValue(field.name); str != "" {
+			if *field.value, err = strconv.ParseFloat(str, 64); err != nil {
+				return "", fmt.Errorf("parse %s: %w", field.name, err)
+			}
+		}
+	}
+	if str := rqst.FormValue("reorder"); str != "" {
+		if settings.Reorder, err = strconv.Atoi(str); err != nil {
+			return "", fmt.Errorf("parse reorder: %w", err)
+		}
+	}
+	if err = s.faults.SetSettings(settings); err != nil {
+		return "", err
+	}
+	return "Fault settings changed", nil
+}
+
+// preFaultsClose closes the connection to the target receiver immediately.
+func preFaultsClose(rqst *http.Request) (string, error) {
+	tgt := rqst.FormValue("target")
+	if rcvr := lsp.GetReceiver(tgt); rcvr == nil {
+		return "", fmt.Errorf("no such receiver '%s'", tgt)
+	} else if err := rcvr.Kill(); err != nil {
+		return "", fmt.Errorf("close %s: %w", tgt, err)
+	}
+	return "Closed connection to " + tgt, nil
+}
@@ -0,0 +1,224 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+)
+
+// historyLimit is the default maximum number of history items shown.
+const historyLimit = 100
+
+// historyItem is the display and JSON version of a message.HistoryItem.
+type historyItem struct {
+	Seq       uint64          `json:"seq"`
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"`
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Type      string          `json:"type"`
+	Method    string          `json:"method,omitempty"`
+	ID        json.RawMessage `json:"id,omitempty"`
+	Size      int             `json:"size"`
+	Pair      uint64          `json:"pair,omitempty"`
+	Message   json.RawMessage `json:"msg"`
+	// Pretty is the indented message JSON for display.
+	Pretty string `json:"-"`
+}
+
+func newHistoryItem(item *message.HistoryItem) *historyItem {
+	hi := &historyItem{
+		Seq:       item.Seq,
+		Time:      item.Time,
+		Direction: item.Arrow(),
+		From:      item.From,
+		To:        item.To,
+		Type:      item.Type,
+		Method:    item.Method,
+		ID:        item.ID,
+		Size:      len(item.Content),
+		Pair:      item.Pair,
+		Message:   item.Content,
+		Pretty:    string(item.Content),
+	}
+	if !json.Valid(item.Content) {
+		hi.Message, _ = json.Marshal(string(item.Content))
+	} else {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, item.Content, "", "  "); err == nil {
+			hi.Pretty = pretty.String()
+		}
+	}
+	return hi
+}
+
+// ShortTime returns the time of the message for display.
+func (hi *historyItem) ShortTime() string {
+	return hi.Time.Format("15:04:05.000")
+}
+
+// IDString returns the message ID for display.
+func (hi *historyItem) IDString() string {
+	return string(hi.ID)
+}
+
+// historyFilter builds a history filter from the request query or form values.
+// The since value is a duration before the current time (e.g. "5m").
+func historyFilter(rqst *http.Request) (*message.HistoryFilter, error) {
+	filter := &message.HistoryFilter{
+		Receiver:  rqst.FormValue("receiver"),
+		Method:    rqst.FormValue("method"),
+		ID:        rqst.FormValue("id"),
+		Direction: rqst.FormValue("direction"),
+		Text:      rqst.FormValue("text"),
+		Limit:     historyLimit,
+	}
+	if since := rqst.FormValue("since"); since != "" {
+		if duration, err := time.ParseDuration(since); err != nil {
+			return nil, fmt.Errorf("parse since: %w", err)
+		} else {
+			filter.Since = time.Now().Add(-duration)
+		}
+	}
+	if limit := rqst.FormValue("limit"); limit != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, fmt.Errorf("parse limit: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// historySelected returns the history item with the sequence number
+// specified by the seq query or form value or nil if there is none.
+func (s *Server) historySelected(rqst *http.Request) (*message.HistoryItem, error) {
+	if seqStr := rqst.FormValue("seq"); seqStr == "" {
+		return nil, nil
+	} else if seq, err := strconv.ParseUint(seqStr, 10, 64); err != nil {
+		return nil, fmt.Errorf("parse seq: %w", err)
+	} else if item := s.history.Get(seq); item == nil {
+		return nil, fmt.Errorf("message %d no longer in history", seq)
+	} else {
+		return item, nil
+	}
+}
+
+func (s *Server) preHistory(rqst *http.Request, anyData data.AnyMap) {
+	if s.history == nil {
+		anyData["errors"] = []string{"Message history not enabled (-history=0)"}
+		return
+	}
+	anyData["size"] = s.history.Size()
+	anyData["action"] = template.URL("/history?" + rqst.URL.RawQuery)
+	anyData["directions"] = []string{message.ToServer, message.ToClient, message.ToTester}
+	errs := make([]string, 0)
+	if rqst.Method == "POST" && rqst.FormValue("form") == "resend" {
+		if err := s.resendHistory(rqst); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			anyData["result"] = []string{"Message sent"}
+		}
+	}
+	filter, err := historyFilter(rqst)
+	if err != nil {
+		errs = append(errs, err.Error())
+		filter = &message.HistoryFilter{Limit: historyLimit}
+	}
+	form := make(map[string]string)
+	for _, field := range []string{"receiver", "method", "id", "direction", "text", "since", "limit"} {
+		form[field] = rqst.FormValue(field)
+	}
+	anyData["form"] = form
+	items := make([]*historyItem, 0)
+	for _, item := range s.history.Search(filter) {
+		items = append(items, newHistoryItem(item))
+	}
+	anyData["items"] = items
+	if selected, err := s.historySelected(rqst); err != nil {
+		errs = append(errs, err.Error())
+	} else if selected != nil {
+		anyData["selected"] = newHistoryItem(selected)
+		if pair := s.history.Get(selected.Pair); pair != nil {
+			// Show request and response side by side.
+			if selected.Type == message.TypeResponse {
+				anyData["left"], anyData["right"] = newHistoryItem(pair), newHistoryItem(selected)
+			} else {
+				anyData["left"], anyData["right"] = newHistoryItem(selected), newHistoryItem(pair)
+			}
+		} else {
+			anyData["left"] = newHistoryItem(selected)
+		}
+	}
+	if len(errs) > 0 {
+		anyData["errors"] = errs
+	}
+}
+
+// resendHistory sends a message from the history to the target receiver.
+// Requests are sent with a new ID so that the response can be distinguished.
+func (s *Server) resendHistory(rqst *http.Request) error {
+	item, err := s.historySelected(rqst)
+	if err != nil {
+		return err
+	} else if item == nil {
+		return errors.New("no message specified")
+	}
+	tgt := rqst.FormValue("target")
+	rcvr := lsp.GetReceiver(tgt)
+	if rcvr == nil {
+		return fmt.Errorf("no such receiver '%s'", tgt)
+	}
+	if item.Type == message.TypeRequest {
+		msg := make(data.AnyMap)
+		if err := json.Unmarshal(item.Content, &msg); err != nil {
+			return fmt.Errorf("unmarshal message: %w", err)
+		} else if err := rcvr.SendMessage(tgt, msg, s.msgLgr); err != nil {
+			return fmt.Errorf("send message to %s: %w", tgt, err)
+		}
+	} else if err := rcvr.SendContent("tester", tgt, item.Content, s.msgLgr); err != nil {
+		return fmt.Errorf("send message to %s: %w", tgt, err)
+	}
+	return nil
+}
+
+// historyJSON returns history items as a JSON array.
+// If a seq value is specified the array contains that item and its pair (if any),
+// otherwise it contains the items matching the filter values, most recent first.
+func (s *Server) historyJSON(w http.ResponseWriter, rqst *http.Request) {
+	if s.history == nil {
+		http.Error(w, "Message history not enabled", http.StatusNotFound)
+		return
+	}
+	items := make([]*historyItem, 0)
+	if selected, err := s.historySelected(rqst); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if selected != nil {
+		items = append(items, newHistoryItem(selected))
+		if pair := s.history.Get(selected.Pair); pair != nil {
+			items = append(items, newHistoryItem(pair))
+		}
+	} else if filter, err := historyFilter(rqst); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else {
+		for _, item := range s.history.Search(filter) {
+			items = append(items, newHistoryItem(item))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(items); err != nil {
+		s.logger.Error().Err(err).Msg("Write history JSON")
+	}
+}
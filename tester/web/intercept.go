@@ -0,0 +1,104 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/intercept"
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+// heldItem is the display version of an intercept.Held message.
+type heldItem struct {
+	*intercept.Held
+	// Pretty is the indented message JSON for editing.
+	Pretty string
+}
+
+// ShortTime returns the time the message was held for display.
+func (hi *heldItem) ShortTime() string {
+	return hi.Time.Format("15:04:05.000")
+}
+
+func (s *Server) preIntercept(rqst *http.Request, anyData data.AnyMap) {
+	if s.intercept == nil {
+		anyData["errors"] = []string{"Intercept only available in Nexus mode"}
+		return
+	}
+	anyData["intercept"] = true
+	anyData["directions"] = []string{message.ToServer, message.ToClient}
+	if rqst.Method == "POST" {
+		if result, err := s.preInterceptPost(rqst); err != nil {
+			anyData["errors"] = []string{err.Error()}
+		} else {
+			anyData["result"] = []string{result}
+		}
+	}
+	anyData["breakpoints"] = s.intercept.Breakpoints()
+	held := make([]*heldItem, 0)
+	for _, h := range s.intercept.Held() {
+		item := &heldItem{Held: h, Pretty: string(h.Content)}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, h.Content, "", "  "); err == nil {
+			item.Pretty = pretty.String()
+		}
+		held = append(held, item)
+	}
+	anyData["held"] = held
+}
+
+func (s *Server) preInterceptPost(rqst *http.Request) (string, error) {
+	var id uint64
+	if idStr := rqst.FormValue("id"); idStr != "" {
+		var err error
+		if id, err = strconv.ParseUint(idStr, 10, 64); err != nil {
+			return "", fmt.Errorf("parse id: %w", err)
+		}
+	}
+	content := []byte(rqst.FormValue("content"))
+	switch rqst.FormValue("form") {
+	case "add":
+		bp := &intercept.Breakpoint{
+			Method:    rqst.FormValue("method"),
+			Direction: rqst.FormValue("direction"),
+			Path:      rqst.FormValue("path"),
+			Value:     rqst.FormValue("value"),
+		}
+		if id, err := s.intercept.AddBreakpoint(bp); err != nil {
+			return "", err
+		} else {
+			return fmt.Sprintf("Breakpoint %d added", id), nil
+		}
+	case "remove":
+		if err := s.intercept.RemoveBreakpoint(id); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Breakpoint %d removed", id), nil
+	case "held":
+		switch action := rqst.FormValue("action"); action {
+		case "forward":
+			if err := s.intercept.Forward(id, content); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Message %d forwarded", id), nil
+		case "duplicate":
+			if err := s.intercept.Duplicate(id, content); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Copy of message %d forwarded", id), nil
+		case "drop":
+			if err := s.intercept.Drop(id); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Message %d dropped", id), nil
+		default:
+			return "", fmt.Errorf("unknown action '%s'", action)
+		}
+	default:
+		return "", fmt.Errorf("unknown form '%s'", rqst.FormValue("form"))
+	}
+}
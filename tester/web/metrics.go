@@ -0,0 +1,205 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/madkins23/lsp-tester/tester/lifecycle"
+	"github.com/madkins23/lsp-tester/tester/message"
+	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
+	"github.com/madkins23/lsp-tester/tester/protocol/sub"
+)
+
+var (
+	_ message.Observer = (*Metrics)(nil)
+	_ http.Handler     = (*Metrics)(nil)
+)
+
+// Metrics counts messages passing through the message.Logger and
+// serves the counts in the Prometheus text exposition format.
+type Metrics struct {
+	messages  map[metricKey]uint64
+	bytes     map[metricKey]uint64
+	errors    map[string]uint64
+	durations map[string]*histogram
+	lifecycle *lifecycle.Tracker
+	lock      sync.Mutex
+}
+
+// metricKey is a pair of label values.
+type metricKey struct {
+	first, second string
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// durationBuckets are the upper bounds in seconds of the request duration histogram buckets.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+const metricPrefix = "lsp_tester_"
+
+func NewMetrics(tracker *lifecycle.Tracker) *Metrics {
+	return &Metrics{
+		lifecycle: tracker,
+		messages:  make(map[metricKey]uint64),
+		bytes:     make(map[metricKey]uint64),
+		errors:    make(map[string]uint64),
+		durations: make(map[string]*histogram),
+	}
+}
+
+// Observe counts a message.
+func (m *Metrics) Observe(entry *message.Entry) {
+	fields := entry.Fields()
+	method := fields.Method
+	if method == "" {
+		method = entry.RequestMethod
+	}
+	var code string
+	if fields.Error {
+		code = errorCode(entry.Content)
+	}
+	size := uint64(len(entry.Content))
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages[metricKey{method, entry.Direction()}]++
+	if entry.From != "tester" {
+		m.bytes[metricKey{entry.From, "in"}] += size
+	}
+	if entry.To != "tester" {
+		m.bytes[metricKey{entry.To, "out"}] += size
+	}
+	if fields.Error {
+		m.errors[code]++
+	}
+	if entry.Latency > 0 {
+		hist, found := m.durations[entry.RequestMethod]
+		if !found {
+			hist = &histogram{buckets: make([]uint64, len(durationBuckets))}
+			m.durations[entry.RequestMethod] = hist
+		}
+		seconds := entry.Latency.Seconds()
+		for i, bound := range durationBuckets {
+			if seconds <= bound {
+				hist.buckets[i]++
+			}
+		}
+		hist.count++
+		hist.sum += seconds
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeHeader(w, "messages_total", "counter", "Messages by method and direction.")
+	for _, key := range sortedPairs(m.messages) {
+		fmt.Fprintf(w, "%smessages_total{method=%s,direction=%s} %d\n",
+			metricPrefix, quoteLabel(key.first), quoteLabel(key.second), m.messages[key])
+	}
+
+	writeHeader(w, "bytes_total", "counter", "Message content bytes by receiver and direction.")
+	for _, key := range sortedPairs(m.bytes) {
+		fmt.Fprintf(w, "%sbytes_total{receiver=%s,direction=%s} %d\n",
+			metricPrefix, quoteLabel(key.first), quoteLabel(key.second), m.bytes[key])
+	}
+
+	writeHeader(w, "request_duration_seconds", "histogram", "Request round-trip time by method.")
+	for _, method := range sortedKeys(m.durations) {
+		hist := m.durations[method]
+		label := quoteLabel(method)
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(w, "%srequest_duration_seconds_bucket{method=%s,le=\"%s\"} %d\n",
+				metricPrefix, label, strconv.FormatFloat(bound, 'g', -1, 64), hist.buckets[i])
+		}
+		fmt.Fprintf(w, "%srequest_duration_seconds_bucket{method=%s,le=\"+Inf\"} %d\n", metricPrefix, label, hist.count)
+		fmt.Fprintf(w, "%srequest_duration_seconds_sum{method=%s} %s\n",
+			metricPrefix, label, strconv.FormatFloat(hist.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%srequest_duration_seconds_count{method=%s} %d\n", metricPrefix, label, hist.count)
+	}
+
+	writeHeader(w, "errors_total", "counter", "Error responses by JSON RPC error code.")
+	for _, code := range sortedKeys(m.errors) {
+		fmt.Fprintf(w, "%serrors_total{code=%s} %d\n", metricPrefix, quoteLabel(code), m.errors[code])
+	}
+
+	writeHeader(w, "connections", "gauge", "Active connections.")
+	fmt.Fprintf(w, "%sconnections %d\n", metricPrefix, lsp.ReceiverCount())
+
+	writeHeader(w, "server_restarts_total", "counter", "Server process restarts.")
+	fmt.Fprintf(w, "%sserver_restarts_total %d\n", metricPrefix, sub.Restarts())
+
+	if m.lifecycle != nil {
+		writeHeader(w, "lifecycle_violations_total", "counter", "LSP lifecycle violations by rule.")
+		for _, violation := range m.lifecycle.Violations() {
+			fmt.Fprintf(w, "%slifecycle_violations_total{rule=%s} %d\n",
+				metricPrefix, quoteLabel(violation.Rule), violation.Count)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricPrefix, name, help, metricPrefix, name, kind)
+}
+
+// errorCode returns the JSON RPC error code from a response as a string.
+func errorCode(content []byte) string {
+	var response struct {
+		Error struct {
+			Code json.Number `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(content, &response); err != nil || response.Error.Code == "" {
+		return "unknown"
+	}
+	return response.Error.Code.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel returns a label value quoted and escaped for the Prometheus text format.
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+// sortedKeys returns the keys of a map in order so that output is stable.
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedPairs returns the keys of a map in order so that output is stable.
+func sortedPairs(values map[metricKey]uint64) []metricKey {
+	keys := make([]metricKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].first != keys[j].first {
+			return keys[i].first < keys[j].first
+		}
+		return keys[i].second < keys[j].second
+	})
+	return keys
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/madkins23/lsp-tester/tester/message"
+)
+
+var _ message.Observer = (*Stream)(nil)
+
+// Stream sends messages passing through the message.Logger
+// to web pages via Server-Sent Events.
+type Stream struct {
+	logger      *zerolog.Logger
+	subscribers map[chan []byte]bool
+	done        chan bool
+	closeOnce   sync.Once
+	lock        sync.Mutex
+}
+
+// streamBuffer is the number of events buffered for each subscriber.
+// Events are dropped for subscribers that fall further behind.
+const streamBuffer = 256
+
+// streamEvent is the JSON data sent for each message.
+type streamEvent struct {
+	Time      string          `json:"time"`
+	Direction string          `json:"direction"`
+	Type      string          `json:"type"`
+	Method    string          `json:"method,omitempty"`
+	ID        json.RawMessage `json:"id,omitempty"`
+	Size      int             `json:"size"`
+	Message   json.RawMessage `json:"msg"`
+}
+
+func NewStream(logger *zerolog.Logger) *Stream {
+	return &Stream{
+		logger:      logger,
+		subscribers: make(map[chan []byte]bool),
+		done:        make(chan bool),
+	}
+}
+
+// Observe sends a message to all subscribers.
+func (st *Stream) Observe(entry *message.Entry) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if len(st.subscribers) < 1 {
+		return
+	}
+
+	fields := entry.Fields()
+	event := &streamEvent{
+		Time:      entry.Time.Format("15:04:05.000"),
+		Direction: entry.Arrow(),
+		Type:      fields.Type,
+		Method:    fields.Method,
+		ID:        fields.ID,
+		Size:      len(entry.Content),
+		Message:   entry.Content,
+	}
+	if !json.Valid(entry.Content) {
+		event.Message, _ = json.Marshal(string(entry.Content))
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		st.logger.Warn().Err(err).Msg("Marshal stream event")
+		return
+	}
+	for subscriber := range st.subscribers {
+		select {
+		case subscriber <- eventJSON:
+		default:
+			// Don't hold up message traffic for a slow browser.
+		}
+	}
+}
+
+// ServeHTTP streams events to a single web page until the page goes away or the Stream is closed.
+func (st *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	subscriber := make(chan []byte, streamBuffer)
+	st.lock.Lock()
+	st.subscribers[subscriber] = true
+	st.lock.Unlock()
+	defer func() {
+		st.lock.Lock()
+		delete(st.subscribers, subscriber)
+		st.lock.Unlock()
+	}()
+
+	for {
+		select {
+		case eventJSON := <-subscriber:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", eventJSON); err != nil {
+				st.logger.Debug().Err(err).Msg("Write stream event")
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-st.done:
+			return
+		}
+	}
+}
+
+// Close ends all event streams so that the HTTP server can shut down.
+func (st *Stream) Close() {
+	st.closeOnce.Do(func() {
+		close(st.done)
+	})
+}
@@ -24,6 +24,10 @@ func NewTerminator(webServer *Server, httpServer *http.Server) app.SubSystem {
 
 func (t *Terminator) Shutdown() error {
 	t.web.logger.Info().Msg("Shutdown")
+	if t.web.stream != nil {
+		// Open event streams would keep the HTTP server from shutting down.
+		t.web.stream.Close()
+	}
 	if t.web.listener != nil {
 		t.web.listener.Close()
 	}
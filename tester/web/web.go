@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
-	"path"
 	"strconv"
 	"sync"
 
@@ -15,28 +14,63 @@ import (
 
 	"github.com/madkins23/go-utils/app"
 
+	"github.com/madkins23/lsp-tester/tester/capability"
+	"github.com/madkins23/lsp-tester/tester/conform"
 	"github.com/madkins23/lsp-tester/tester/data"
+	"github.com/madkins23/lsp-tester/tester/fault"
 	"github.com/madkins23/lsp-tester/tester/flags"
+	"github.com/madkins23/lsp-tester/tester/intercept"
+	"github.com/madkins23/lsp-tester/tester/lifecycle"
 	"github.com/madkins23/lsp-tester/tester/logging"
 	"github.com/madkins23/lsp-tester/tester/message"
 	"github.com/madkins23/lsp-tester/tester/protocol/lsp"
-	"github.com/madkins23/lsp-tester/tester/protocol/tcp"
+	"github.com/madkins23/lsp-tester/tester/protocol/sub"
 )
 
+// Listener accepts client connections and is closed when the web server shuts down.
+type Listener interface {
+	Close()
+}
+
 type Server struct {
 	flags      *flags.Set
-	listener   *tcp.Listener
+	listener   Listener
 	logger     *zerolog.Logger
 	logMgr     *logging.Manager
 	msgLgr     *message.Logger
+	history    *message.History
+	intercept  *intercept.Interceptor
+	faults     *fault.Injector
+	stderr     *sub.Stderr
+	checker    *conform.Checker
+	lifecycle  *lifecycle.Tracker
+	capability *capability.Reporter
 	messages   *message.Files
+	stream     *Stream
+	stats      *Stats
+	exitChan   chan bool
 	terminator *app.Terminator
 	waiter     *sync.WaitGroup
 }
 
-func NewWebServer(flags *flags.Set, listener *tcp.Listener, logMgr *logging.Manager,
-	msgLgr *message.Logger, waiter *sync.WaitGroup, terminator *app.Terminator) *Server {
+// Options are the optional subsystems shown by the web server.
+// A page for a nil subsystem explains how to enable it.
+type Options struct {
+	History     *message.History
+	Interceptor *intercept.Interceptor
+	Injector    *fault.Injector
+	Stderr      *sub.Stderr
+	Checker     *conform.Checker
+	Tracker     *lifecycle.Tracker
+	Reporter    *capability.Reporter
+}
+
+func NewWebServer(flags *flags.Set, listener Listener, logMgr *logging.Manager,
+	msgLgr *message.Logger, options *Options, waiter *sync.WaitGroup, terminator *app.Terminator) *Server {
 	//
+	if options == nil {
+		options = &Options{}
+	}
 	logger := log.With().Str("svc", "web").Logger()
 	return &Server{
 		flags:      flags,
@@ -44,8 +78,16 @@ func NewWebServer(flags *flags.Set, listener *tcp.Listener, logMgr *logging.Mana
 		logger:     &logger,
 		logMgr:     logMgr,
 		msgLgr:     msgLgr,
+		history:    options.History,
+		intercept:  options.Interceptor,
+		faults:     options.Injector,
+		stderr:     options.Stderr,
+		checker:    options.Checker,
+		lifecycle:  options.Tracker,
+		capability: options.Reporter,
 		terminator: terminator,
 		waiter:     waiter,
+		exitChan:   make(chan bool, 1),
 	}
 }
 
@@ -67,8 +109,7 @@ func (s *Server) Serve() {
 	}
 
 	anyData := data.AnyMap{
-		"messages":  s.messages.List(),
-		"receivers": lsp.Receivers(),
+		"messages": s.messages.List(),
 	}
 
 	const configurePageError = "Configuring page handler"
@@ -78,7 +119,53 @@ func (s *Server) Serve() {
 		s.logger.Error().Err(err).Str("page", "main").Msg(configurePageError)
 	}
 
-	for _, name := range []string{"home.png", "bomb.png"} {
+	s.stream = NewStream(s.logger)
+	s.msgLgr.AddObserver(s.stream)
+	http.Handle("/log/events", s.stream)
+	if err := s.handlePage("log", "/log", nil, nil, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "log").Msg(configurePageError)
+	}
+
+	if err := s.handlePage("history", "/history", anyData, s.preHistory, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "history").Msg(configurePageError)
+	}
+	http.HandleFunc("/history.json", s.historyJSON)
+
+	if err := s.handlePage("intercept", "/intercept", anyData, s.preIntercept, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "intercept").Msg(configurePageError)
+	}
+
+	if err := s.handlePage("faults", "/faults", anyData, s.preFaults, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "faults").Msg(configurePageError)
+	}
+
+	if err := s.handlePage("latency", "/latency", anyData, s.preLatency, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "latency").Msg(configurePageError)
+	}
+
+	if err := s.handlePage("stderr", "/stderr", anyData, s.preStderr, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "stderr").Msg(configurePageError)
+	}
+
+	if err := s.handlePage("documents", "/documents", anyData, s.preDocuments, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "documents").Msg(configurePageError)
+	}
+
+	if err := s.handlePage("conformance", "/conformance", anyData, s.preConformance, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "conformance").Msg(configurePageError)
+	}
+
+	if err := s.handlePage("capabilities", "/capabilities", anyData, s.preCapabilities, nil); err != nil {
+		s.logger.Error().Err(err).Str("page", "capabilities").Msg(configurePageError)
+	}
+
+	s.handleAPI()
+
+	metrics := NewMetrics(s.lifecycle)
+	s.msgLgr.AddObserver(metrics)
+	http.Handle("/metrics", metrics)
+
+	for _, name := range []string{"home.png", "log.png", "history.png", "intercept.png", "faults.png", "latency.png", "stderr.png", "documents.png", "conformance.png", "capabilities.png", "bomb.png"} {
 		if err := s.handleImage(name); err != nil {
 			s.logger.Error().Err(err).Str("image", name).Msg(configureImageError)
 		}
@@ -91,10 +178,9 @@ func (s *Server) Serve() {
 	// Use channel and goroutine to:
 	// * delay shutdown until exit page is shown and
 	// * prevent web service shutdown from hanging and keeping app alive.
-	exitChan := make(chan bool)
 	s.terminator.Add(NewTerminator(s, server))
 	go func() {
-		<-exitChan
+		<-s.exitChan
 		if err := s.terminator.Shutdown(); err != nil {
 			s.logger.Error().Err(err).Msg("Terminating")
 		}
@@ -104,7 +190,7 @@ func (s *Server) Serve() {
 		anyData["exit"] = true
 	}, func(_ *http.Request, _ data.AnyMap) {
 		s.logger.Info().Msg("Exit")
-		exitChan <- true
+		s.exit()
 	}); err != nil {
 		s.logger.Error().Err(err).Str("page", "exit").Msg(configurePageError)
 	}
@@ -114,6 +200,15 @@ func (s *Server) Serve() {
 	}
 }
 
+// exit starts shutdown of the application.
+// Only the first call has any effect.
+func (s *Server) exit() {
+	select {
+	case s.exitChan <- true:
+	default:
+	}
+}
+
 //go:embed template
 var webPages embed.FS
 
@@ -152,6 +247,7 @@ func (s *Server) handlePage(name, url string, startData data.AnyMap, pre, post f
 			anyData["lastMessage"] = lastMessage
 			anyData["lastTarget"] = lastTarget
 			anyData["page"] = name
+			anyData["receivers"] = lsp.Receivers()
 			anyData["stdFormat"] = data.AnyMap{
 				"formatName": "Console",
 				"logFormat":  s.logMgr.StdFormat(),
@@ -189,7 +285,49 @@ func (s *Server) preMain(rqst *http.Request, data data.AnyMap) {
 			s.preSendMessagePost(rqst, data)
 		case "format":
 			s.preLogFormatPost(rqst, data)
+		case "compose":
+			s.preComposePost(rqst, data)
+		}
+	} else if rqst.FormValue("edit") != "" || rqst.FormValue("seq") != "" {
+		s.preComposeLoad(rqst, data)
+	}
+}
+
+func (s *Server) preLatency(_ *http.Request, anyData data.AnyMap) {
+	anyData["latency"] = s.msgLgr.Latency().Summary()
+}
+
+func (s *Server) preStderr(_ *http.Request, anyData data.AnyMap) {
+	anyData["capture"] = s.stderr != nil
+	if s.stderr != nil {
+		anyData["lines"] = s.stderr.Lines()
+	}
+}
+
+func (s *Server) preDocuments(rqst *http.Request, anyData data.AnyMap) {
+	if uri := rqst.FormValue("uri"); uri != "" {
+		if doc := s.msgLgr.Documents().Get(uri); doc != nil {
+			anyData["document"] = doc
+			return
 		}
+		anyData["missing"] = uri
+	}
+	anyData["documents"] = s.msgLgr.Documents().List()
+}
+
+func (s *Server) preConformance(_ *http.Request, anyData data.AnyMap) {
+	anyData["checking"] = s.checker != nil
+	if s.checker != nil {
+		anyData["version"] = s.checker.Version()
+		anyData["summary"] = s.checker.Summary()
+		anyData["problems"] = s.checker.Problems()
+	}
+}
+
+func (s *Server) preCapabilities(_ *http.Request, anyData data.AnyMap) {
+	anyData["reporting"] = s.capability != nil
+	if s.capability != nil {
+		anyData["reports"] = s.capability.Reports()
 	}
 }
 
@@ -229,7 +367,9 @@ func (s *Server) preSendMessagePost(rqst *http.Request, data data.AnyMap) {
 	}
 	if msg = rqst.FormValue("message"); msg == "" {
 		errs = append(errs, "No message specified")
-	} else if rqst, err := message.LoadMessage(path.Join(s.flags.MessageDir(), msg)); err != nil {
+	} else if msgPath, err := s.messages.Path(msg); err != nil {
+		errs = append(errs, err.Error())
+	} else if rqst, err := message.LoadMessage(msgPath); err != nil {
 		errs = append(errs,
 			fmt.Sprintf("Load request from file %s: %s", msg, err))
 	} else {